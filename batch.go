@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/balpha/go-unicornify/unicornify"
+)
+
+type batchJob struct {
+	line    int
+	input   string
+	hash    string
+	outfile string
+}
+
+type batchFailure struct {
+	line  int
+	input string
+	err   string
+}
+
+func batch(args []string) {
+	var infile, outdir, nameTemplate, hashAlg string
+	var workers int
+	var ids, header bool
+	var rf renderFlags
+	var ff formatFlags
+
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags.StringVar(&infile, "i", "", "the file to read emails or hashes from, one per line (optionally followed by a comma and an output name); defaults to stdin")
+	flags.StringVar(&outdir, "outdir", ".", "the directory to write the avatars into")
+	flags.StringVar(&nameTemplate, "name", "{name}.{ext}", "the filename template; {hash} is replaced with the hash, {name} with the output name from the input (or the hash if there is none), {line} with the line number, {ext} with the file extension of the output format")
+	flags.StringVar(&hashAlg, "hashalg", "md5", "the algorithm used for hashing email addresses: md5 or sha256")
+	flags.BoolVar(&ids, "id", false, "treat each input as an identifier (as with -id in normal mode) rather than an email address or hash")
+	flags.BoolVar(&header, "header", false, "skip the first line of the input, which holds the column names as in many CSV files; without -id, such a line is also skipped if it is neither an email address nor a hash")
+	flags.IntVar(&workers, "j", runtime.NumCPU(), "the number of avatars to render at the same time")
+	rf.register(flags)
+	ff.register(flags)
+	flags.Parse(args)
+
+	if msg := rf.check(); msg != "" {
+		os.Stderr.WriteString(msg + "\n")
+		os.Exit(1)
+	}
+	alg, err := unicornify.ParseHashAlgorithm(hashAlg)
+	if err != nil {
+		os.Stderr.WriteString("Unknown hash algorithm (argument to -hashalg) " + hashAlg + "; must be md5 or sha256\n")
+		os.Exit(1)
+	}
+	if workers <= 0 {
+		os.Stderr.WriteString("Number of workers (argument to -j) must be a positive number\n")
+		os.Exit(1)
+	}
+	format, msg := ff.resolve(nameTemplate, unicornify.PNG)
+	if msg != "" {
+		os.Stderr.WriteString(msg + "\n")
+		os.Exit(1)
+	}
+	nameTemplate = strings.Replace(nameTemplate, "{ext}", format.Extension(), -1)
+	if !strings.Contains(nameTemplate, "{hash}") && !strings.Contains(nameTemplate, "{name}") && !strings.Contains(nameTemplate, "{line}") {
+		os.Stderr.WriteString("Filename template (argument to -name) must contain {hash}, {name}, or {line}\n")
+		os.Exit(1)
+	}
+
+	var in io.Reader = os.Stdin
+	if infile != "" {
+		f, err := os.Open(infile)
+		if err != nil {
+			os.Stderr.WriteString("Could not open input file " + infile + "\n")
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	if err := os.MkdirAll(outdir, 0o755); err != nil {
+		os.Stderr.WriteString("Could not create output directory " + outdir + "\n")
+		os.Exit(1)
+	}
+
+	jobs, failures, err := readBatch(in, outdir, nameTemplate, alg, ids, header)
+	if err != nil {
+		os.Stderr.WriteString("Error reading input: " + err.Error() + "\n")
+		os.Exit(1)
+	}
+
+	opts := rf.options()
+	// the workers share the CPUs
+	opts.Concurrency = runtime.NumCPU() / workers
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	fmt.Printf("Creating %v size %v avatars in %v\n", len(jobs), rf.size.String(), outdir)
+
+	jobChan := make(chan batchJob)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	done, created := 0, 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				err := renderBatchJob(job, opts, format, &ff)
+				mutex.Lock()
+				done++
+				if err != nil {
+					failures = append(failures, batchFailure{job.line, job.input, err.Error()})
+				} else {
+					created++
+				}
+				fmt.Printf("\r%v/%v    ", done, len(jobs))
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		jobChan <- job
+	}
+	close(jobChan)
+	wg.Wait()
+	fmt.Print("\r    \r")
+
+	fmt.Printf("Created %v avatars, %v failed\n", created, len(failures))
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].line < failures[j].line })
+		for _, f := range failures {
+			os.Stderr.WriteString(fmt.Sprintf("line %v (%v): %v\n", f.line, f.input, f.err))
+		}
+		os.Exit(1)
+	}
+}
+
+// readBatch parses the input into jobs. Each line is an identifier (if ids is
+// true), an email address (if it contains an @), or a hash, optionally followed
+// by a comma and an output name.
+// Empty lines and lines starting with # are ignored, as is the first of the
+// other lines if header is true or if it is a header row like "email,name"
+// (see isHeader). Lines that can't be used are returned as failures.
+func readBatch(in io.Reader, outdir, nameTemplate string, alg unicornify.HashAlgorithm, ids, header bool) ([]batchJob, []batchFailure, error) {
+	var jobs []batchJob
+	var failures []batchFailure
+	seen := make(map[string]int)
+	first := true
+
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r := csv.NewReader(strings.NewReader(text))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		record, err := r.Read()
+		if err != nil {
+			failures = append(failures, batchFailure{line, text, "invalid CSV"})
+			continue
+		}
+		input := strings.TrimSpace(record[0])
+		if first {
+			first = false
+			if header || (!ids && isHeader(input)) {
+				continue
+			}
+		}
+		if len(record) > 2 {
+			failures = append(failures, batchFailure{line, text, "too many columns"})
+			continue
+		}
+		if input == "" {
+			failures = append(failures, batchFailure{line, text, "empty input"})
+			continue
+		}
+		hash := input
+		if ids {
+			hash = unicornify.HashID(input)
+		} else if strings.Contains(input, "@") {
+			hash = unicornify.HashEmail(input, alg)
+		}
+		name := hash
+		if len(record) == 2 && strings.TrimSpace(record[1]) != "" {
+			name = strings.TrimSpace(record[1])
+		}
+
+		filename := strings.NewReplacer("{hash}", hash, "{name}", name, "{line}", strconv.Itoa(line)).Replace(nameTemplate)
+		if filename != filepath.Base(filename) || filename == ".." || filename == "." {
+			failures = append(failures, batchFailure{line, input, "invalid output name " + filename})
+			continue
+		}
+		if prev, ok := seen[filename]; ok {
+			failures = append(failures, batchFailure{line, input, fmt.Sprintf("output name %v already used in line %v", filename, prev)})
+			continue
+		}
+		seen[filename] = line
+		jobs = append(jobs, batchJob{line, input, hash, filepath.Join(outdir, filename)})
+	}
+	return jobs, failures, scanner.Err()
+}
+
+// isHeader reports whether the first column of a line can't be an email
+// address or a hash, and is therefore taken to be a column name.
+func isHeader(input string) bool {
+	if input == "" || strings.Contains(input, "@") {
+		return false
+	}
+	for _, c := range strings.ToLower(input) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return true
+		}
+	}
+	return false
+}
+
+func renderBatchJob(job batchJob, opts unicornify.Options, format unicornify.Format, ff *formatFlags) error {
+	if format.Name == "svg" {
+		svg, _, err := unicornify.RenderSVG(context.Background(), job.hash, opts)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(job.outfile, svg, 0o644); err != nil {
+			return fmt.Errorf("error writing to output file %v", job.outfile)
+		}
+		return nil
+	}
+	img, allData, err := unicornify.RenderNRGBA(context.Background(), job.hash, opts)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(job.outfile)
+	if err != nil {
+		return fmt.Errorf("could not create output file %v", job.outfile)
+	}
+	defer f.Close()
+	buf := bufio.NewWriter(f)
+	err = ff.encode(buf, img, format, job.hash, opts, allData)
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing to output file %v", job.outfile)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/balpha/go-unicornify/unicornify"
+)
+
+func TestReadBatch(t *testing.T) {
+	aliceHash := unicornify.HashEmail("alice@example.com", unicornify.MD5)
+	tests := []struct {
+		name      string
+		input     string
+		ids       bool
+		header    bool
+		wantJobs  []string // line:hash:file
+		wantFails []int    // line numbers
+	}{
+		{
+			name:     "hashes and emails",
+			input:    "ffff\nalice@example.com,alice\n",
+			wantJobs: []string{"1:ffff:ffff.png", "2:" + aliceHash + ":alice.png"},
+		},
+		{
+			name:     "blank and comment lines",
+			input:    "\n# the team\n   \nffff\n  # more\nabc,x\n\n",
+			wantJobs: []string{"4:ffff:ffff.png", "6:abc:x.png"},
+		},
+		{
+			name:     "detected header",
+			input:    "email,name\nalice@example.com,alice\n",
+			wantJobs: []string{"2:" + aliceHash + ":alice.png"},
+		},
+		{
+			name:     "detected header with more columns",
+			input:    "# export\nEmail, Name, Department\nffff\n",
+			wantJobs: []string{"3:ffff:ffff.png"},
+		},
+		{
+			name:      "only the first line can be a header",
+			input:     "ffff\nemail,name,dept\n",
+			wantJobs:  []string{"1:ffff:ffff.png"},
+			wantFails: []int{2},
+		},
+		{
+			name:     "hash in the first line is not a header",
+			input:    "beef,cow\nffff\n",
+			wantJobs: []string{"1:beef:cow.png", "2:ffff:ffff.png"},
+		},
+		{
+			name:     "explicit header",
+			input:    "beef,cow\nffff\n",
+			header:   true,
+			wantJobs: []string{"2:ffff:ffff.png"},
+		},
+		{
+			name:     "ids are never detected as header",
+			input:    "username,file\nalice,a\n",
+			ids:      true,
+			wantJobs: []string{"1:" + unicornify.HashID("username") + ":file.png", "2:" + unicornify.HashID("alice") + ":a.png"},
+		},
+		{
+			name:     "explicit header with ids",
+			input:    "username,file\nalice,a\n",
+			ids:      true,
+			header:   true,
+			wantJobs: []string{"2:" + unicornify.HashID("alice") + ":a.png"},
+		},
+		{
+			name:      "failures",
+			input:     "ffff\n\"open\n,name\nffff,x,y\nabc,ffff\n",
+			wantJobs:  []string{"1:ffff:ffff.png"},
+			wantFails: []int{2, 3, 4, 5},
+		},
+	}
+	for _, tt := range tests {
+		jobs, failures, err := readBatch(strings.NewReader(tt.input), "out", "{name}.png", unicornify.MD5, tt.ids, tt.header)
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		var gotJobs []string
+		for _, j := range jobs {
+			file, _ := filepath.Rel("out", j.outfile)
+			gotJobs = append(gotJobs, strings.Join([]string{strconv.Itoa(j.line), j.hash, file}, ":"))
+		}
+		if strings.Join(gotJobs, " ") != strings.Join(tt.wantJobs, " ") {
+			t.Errorf("%v: got jobs %v, want %v", tt.name, gotJobs, tt.wantJobs)
+		}
+		var gotFails []int
+		for _, f := range failures {
+			gotFails = append(gotFails, f.line)
+		}
+		if len(gotFails) != len(tt.wantFails) {
+			t.Errorf("%v: got failures %v, want lines %v", tt.name, failures, tt.wantFails)
+			continue
+		}
+		for i := range gotFails {
+			if gotFails[i] != tt.wantFails[i] {
+				t.Errorf("%v: got failures %v, want lines %v", tt.name, failures, tt.wantFails)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/balpha/go-unicornify/unicornify"
+)
+
+// renderFlags are the command line flags that control how a unicorn is
+// rendered; they are shared between the normal mode and batch mode.
+type renderFlags struct {
+	size                                        sizeFlag
+	aa                                          int
+	filter                                      string
+	free, zoomOut, nodouble, noshading, nograss bool
+	linear, wings                               bool
+	pose                                        string
+	overrides                                   overrideFlags
+}
+
+func (rf *renderFlags) register(flags *flag.FlagSet) {
+	rf.size = sizeFlag{256, 256}
+	flags.Var(&rf.size, "s", "the size of the generated unicorn avatar in pixels (in either direction), or width and height as in 600x200")
+	flags.BoolVar(&rf.free, "f", false, "generate a free unicorn avatar, i.e. with a transparent background (implies -nograss)")
+	flags.BoolVar(&rf.zoomOut, "z", false, "zoom out, so the unicorn is fully visible")
+	flags.BoolVar(&rf.nodouble, "noaa", false, "no antialiasing (same as -aa 1)")
+	flags.IntVar(&rf.aa, "aa", 2, "the antialiasing factor, i.e. render at this multiple of the size and scale down (1, 2, 3, 4, or 8)")
+	flags.StringVar(&rf.filter, "filter", "box", "the filter used for scaling down when antialiasing: box, tent, or lanczos")
+	flags.BoolVar(&rf.noshading, "noshading", false, "do not add shading, this will make unicorns look flatter")
+	flags.BoolVar(&rf.nograss, "nograss", false, "do not add grass to the ground")
+	flags.BoolVar(&rf.linear, "linear", false, "mix colors and antialias in linear light, which avoids darkened edges (the result differs slightly from earlier versions)")
+	flags.StringVar(&rf.pose, "pose", "", "the unicorn's pose instead of the one derived from the hash: "+strings.Join(unicornify.PoseNames[:], ", "))
+	flags.BoolVar(&rf.wings, "wings", false, "give the unicorn feathered wings; their shape and color depend on the unicorn")
+	flags.Var(&rf.overrides, "set", "override a value of the unicorn data, e.g. -set HornHue=50 (can be given multiple times; angles in degrees)")
+}
+
+// check returns an error message if the flags are invalid, or "" otherwise.
+func (rf *renderFlags) check() string {
+	if rf.size.width <= 0 || rf.size.height <= 0 {
+		return "Size (argument to -s) must be positive"
+	}
+	switch rf.aa {
+	case 1, 2, 3, 4, 8:
+	default:
+		return "Antialiasing factor (argument to -aa) must be 1, 2, 3, 4, or 8"
+	}
+	if _, err := unicornify.ParseFilter(rf.filter); err != nil {
+		return "Unknown filter (argument to -filter) " + rf.filter + "; must be box, tent, or lanczos"
+	}
+	if rf.pose != "" {
+		if _, err := unicornify.ParsePose(rf.pose); err != nil {
+			return "Unknown pose (argument to -pose) " + rf.pose + "; must be one of " + strings.Join(unicornify.PoseNames[:], ", ")
+		}
+	}
+	return ""
+}
+
+func (rf *renderFlags) options() unicornify.Options {
+	opts := unicornify.Options{
+		Size:         rf.size.width,
+		Background:   !rf.free,
+		ZoomOut:      rf.zoomOut,
+		Shading:      !rf.noshading,
+		Grass:        !rf.nograss && !rf.free,
+		Antialiasing: rf.aa,
+		LinearLight:  rf.linear,
+		Overrides:    rf.overrides,
+	}
+	// -pose and -wings come first, so -set can still change their values
+	var forced []unicornify.Override
+	if rf.pose != "" {
+		pose, _ := unicornify.ParsePose(rf.pose)
+		forced = append(forced, unicornify.Override{Field: "PoseKindIndex", Value: float64(pose)})
+	}
+	if rf.wings {
+		forced = append(forced, unicornify.Override{Field: "HasWings", Value: 1})
+	}
+	if forced != nil {
+		opts.Overrides = append(forced, rf.overrides...)
+	}
+	opts.Filter, _ = unicornify.ParseFilter(rf.filter)
+	if rf.size.width != rf.size.height {
+		opts.Width, opts.Height = rf.size.width, rf.size.height
+	}
+	if rf.nodouble {
+		opts.Antialiasing = 1
+	}
+	return opts
+}
+
+// formatFlags are the command line flags that select the output format.
+type formatFlags struct {
+	format  string
+	quality int
+	meta    string
+}
+
+func (ff *formatFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&ff.format, "format", "", "the output format: png, jpeg, gif, or svg; defaults to the extension of the output file, or png")
+	flags.IntVar(&ff.quality, "quality", unicornify.DefaultJPEGQuality, "the JPEG quality from 1 to 100")
+	flags.StringVar(&ff.meta, "meta", "basic", "the metadata stored in PNG files: none, basic (hash, options, and version), or full (also all the unicorn data)")
+}
+
+// resolve returns the output format, taking it from the extension of filename
+// (if given) when -format wasn't used, and fallback otherwise. It returns an
+// error message if the flags are invalid.
+func (ff *formatFlags) resolve(filename string, fallback unicornify.Format) (unicornify.Format, string) {
+	if ff.meta != "none" && ff.meta != "basic" && ff.meta != "full" {
+		return unicornify.Format{}, "Metadata (argument to -meta) must be none, basic, or full"
+	}
+	if ff.quality < 1 || ff.quality > 100 {
+		return unicornify.Format{}, "Quality (argument to -quality) must be between 1 and 100"
+	}
+	format := fallback
+	if ff.format != "" {
+		f, err := unicornify.ParseFormat(ff.format)
+		if err != nil {
+			return unicornify.Format{}, "Unknown format (argument to -format) " + ff.format + "; must be png, jpeg, gif, or svg"
+		}
+		format = f
+	} else if f, err := unicornify.ParseFormat(filepath.Ext(filename)); err == nil {
+		format = f
+	}
+	format.Quality = ff.quality
+	return format, ""
+}
+
+// encode writes img in the given format, including the metadata requested by
+// -meta. hash is empty if the unicorn was rendered from data; in that case, the
+// data is always included so the image can be rendered again.
+func (ff *formatFlags) encode(w io.Writer, img *image.NRGBA, format unicornify.Format, hash string, opts unicornify.Options, data unicornify.AllData) error {
+	if ff.meta == "none" {
+		return unicornify.Encode(w, img, format)
+	}
+	meta := unicornify.Metadata{
+		Hash:    hash,
+		Options: opts,
+		Version: programVersion(),
+	}
+	if ff.meta == "full" || hash == "" {
+		meta.Data = &data
+	}
+	return unicornify.EncodeWithMetadata(w, img, format, meta)
+}
+
+// sizeFlag is the argument to -s, either a single number for square images or
+// width and height separated by an x.
+type sizeFlag struct {
+	width, height int
+}
+
+func (s *sizeFlag) String() string {
+	if s.width == s.height {
+		return strconv.Itoa(s.width)
+	}
+	return fmt.Sprintf("%vx%v", s.width, s.height)
+}
+
+func (s *sizeFlag) Set(value string) error {
+	parts := strings.Split(strings.ToLower(value), "x")
+	if len(parts) > 2 {
+		return fmt.Errorf("size %q must be a number or have the form WIDTHxHEIGHT", value)
+	}
+	var dims []int
+	for _, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return fmt.Errorf("size %q must be a number or have the form WIDTHxHEIGHT", value)
+		}
+		dims = append(dims, n)
+	}
+	s.width, s.height = dims[0], dims[len(dims)-1]
+	return nil
+}
+
+// overrideFlags collects the -set flags.
+type overrideFlags []unicornify.Override
+
+func (o *overrideFlags) String() string {
+	parts := make([]string, len(*o))
+	for i, ov := range *o {
+		parts[i] = fmt.Sprintf("%v=%v", ov.Field, ov.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (o *overrideFlags) Set(value string) error {
+	ov, err := unicornify.ParseOverride(value)
+	if err != nil {
+		return err
+	}
+	*o = append(*o, ov)
+	return nil
+}
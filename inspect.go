@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+
+	"github.com/balpha/go-unicornify/unicornify"
+)
+
+func inspect(args []string) {
+	var outfile, datafile string
+	var verify bool
+
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	flags.StringVar(&outfile, "o", "", "if given, render the unicorn again and write it into a PNG file of this name")
+	flags.BoolVar(&verify, "verify", false, "render the unicorn again and check that the result is identical to the file")
+	flags.StringVar(&datafile, "dataout", "", "if given and the file contains the unicorn data, write it into a JSON file of this name")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %v inspect [options] file.png\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	infile := flags.Arg(0)
+
+	content, err := os.ReadFile(infile)
+	if err != nil {
+		os.Stderr.WriteString("Could not read file " + infile + "\n")
+		os.Exit(1)
+	}
+	meta, err := unicornify.ReadMetadata(bytes.NewReader(content))
+	if err != nil {
+		os.Stderr.WriteString(infile + ": " + err.Error() + "\n")
+		os.Exit(1)
+	}
+
+	options, err := json.MarshalIndent(meta.Options, "", "  ")
+	if err != nil {
+		os.Stderr.WriteString("Error formatting options\n")
+		os.Exit(1)
+	}
+	fmt.Printf("Version: %v\n", meta.Version)
+	if meta.Hash != "" {
+		fmt.Printf("Hash: %v\n", meta.Hash)
+	} else {
+		fmt.Println("Hash: none (rendered from data)")
+	}
+	fmt.Printf("Unicorn data included: %v\n", meta.Data != nil)
+	fmt.Printf("Options: %s\n", options)
+
+	if datafile != "" {
+		if meta.Data == nil {
+			os.Stderr.WriteString("The file does not contain the unicorn data\n")
+			os.Exit(1)
+		}
+		json, err := json.MarshalIndent(meta.Data, "", "  ")
+		if err == nil {
+			err = os.WriteFile(datafile, json, 0o644)
+		}
+		if err != nil {
+			os.Stderr.WriteString("Error writing data file\n")
+			os.Exit(1)
+		}
+	}
+
+	if outfile == "" && !verify {
+		return
+	}
+
+	if meta.Version != programVersion() {
+		fmt.Printf("Note: the file was created by version %v, this is version %v; the result may differ\n", meta.Version, programVersion())
+	}
+	var img *image.NRGBA
+	ctx := context.Background()
+	if meta.Hash != "" {
+		img, _, err = unicornify.RenderNRGBA(ctx, meta.Hash, meta.Options)
+	} else if meta.Data != nil {
+		img, _, err = unicornify.RenderNRGBAFromData(ctx, *meta.Data, meta.Options)
+	} else {
+		err = fmt.Errorf("the file contains neither a hash nor the unicorn data")
+	}
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+
+	if outfile != "" {
+		f, err := os.Create(outfile)
+		if err != nil {
+			os.Stderr.WriteString("Could not create output file " + outfile + "\n")
+			os.Exit(1)
+		}
+		defer f.Close()
+		buf := bufio.NewWriter(f)
+		err = unicornify.EncodeWithMetadata(buf, img, unicornify.PNG, meta)
+		if err == nil {
+			err = buf.Flush()
+		}
+		if err != nil {
+			os.Stderr.WriteString("Error writing to output file\n")
+			os.Exit(1)
+		}
+		fmt.Printf("Rendered again into %v\n", outfile)
+	}
+
+	if verify {
+		original, err := png.Decode(bytes.NewReader(content))
+		if err != nil {
+			os.Stderr.WriteString("Could not decode " + infile + "\n")
+			os.Exit(1)
+		}
+		if !sameImage(original, img) {
+			fmt.Println("The image rendered again differs from the file")
+			os.Exit(1)
+		}
+		fmt.Println("The image rendered again is identical to the file")
+	}
+}
+
+func sameImage(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if color.NRGBAModel.Convert(a.At(x, y)) != color.NRGBAModel.Convert(b.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
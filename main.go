@@ -2,132 +2,531 @@ package main
 
 import (
 	"bufio"
-	"crypto/md5"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/png"
+	"io"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/balpha/go-unicornify/unicornify"
 )
 
+// version is the program version stored in the metadata of PNG files; it can
+// be set at build time with -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+func programVersion() string {
+	if version == "dev" {
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+	}
+	return version
+}
+
 func main() {
-	var mail, hash string
-	var random, free, zoomOut, nodouble, noshading, nograss, serial bool
-	var size int
-	var outfile, datafile string
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		batch(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		inspect(os.Args[2:])
+		return
+	}
+
+	var mail, hash, hashAlg, id string
+	var random, serial bool
+	var animate, turntable, columns, meshres int
+	var elevation *float64
+	var outfile, datafile, datain, depthfile, normalfile, maskfile, meshfile, timelinefile, y4mfile string
+	var rf renderFlags
+	var ff formatFlags
 
 	flag.StringVar(&mail, "m", "", "the email address for which a unicorn avatar should be generated")
+	flag.StringVar(&hashAlg, "hashalg", "md5", "the algorithm used for hashing the email address given with -m: md5 or sha256")
+	flag.StringVar(&id, "id", "", "an identifier like a username, UUID, or numeric ID for which a unicorn avatar should be generated")
 	flag.StringVar(&hash, "h", "", "the hash for which a unicorn avatar should be generated")
 	flag.BoolVar(&random, "r", false, "generate a random unicorn avatar")
-	flag.IntVar(&size, "s", 256, "the size of the generated unicorn avatar in pixels (in either direction)")
-	flag.StringVar(&outfile, "o", "", "filename of the output PNG image, defaults to {hash}.png")
-	flag.BoolVar(&free, "f", false, "generate a free unicorn avatar, i.e. with a transparent background (implies -nograss)")
-	flag.BoolVar(&zoomOut, "z", false, "zoom out, so the unicorn is fully visible")
-	flag.BoolVar(&nodouble, "noaa", false, "no antialiasing")
-	flag.BoolVar(&noshading, "noshading", false, "do not add shading, this will make unicorns look flatter")
-	flag.BoolVar(&nograss, "nograss", false, "do not add grass to the ground")
+	flag.StringVar(&outfile, "o", "", "filename of the output image, or - for stdout; defaults to {hash}.png (or {hash}.gif with -animate or -turntable); with -timeline, the frame number is inserted before the extension")
+	rf.register(flag.CommandLine)
+	ff.register(flag.CommandLine)
 	flag.BoolVar(&serial, "serial", false, "do not parallelize the drawing")
 	flag.StringVar(&datafile, "dataout", "", "if given, a JSON file of this name will be created with all the unicorn data")
+	flag.StringVar(&depthfile, "depthout", "", "if given, a 16-bit grayscale PNG file of this name will be created with the depth map of the unicorn (and grass)")
+	flag.StringVar(&normalfile, "normalout", "", "if given, a PNG file of this name will be created with the normal map of the unicorn (and grass)")
+	flag.StringVar(&maskfile, "maskout", "", "if given, an indexed PNG file of this name will be created with a segmentation mask of the image, along with a JSON legend of the same name ending in .json")
+	flag.StringVar(&meshfile, "meshout", "", "if given, a triangle mesh of the unicorn will be written to this file, e.g. for 3D printing; the format (stl, obj, or gltf) is taken from the extension")
+	flag.IntVar(&meshres, "meshres", unicornify.DefaultMeshResolution, "the resolution of the mesh created with -meshout, i.e. the number of grid cells along the longest side of the unicorn")
+	flag.StringVar(&datain, "datain", "", "render the unicorn described by this JSON file (as created by -dataout) instead of generating one")
+	flag.IntVar(&animate, "animate", 0, "if given, create an animated GIF with this many frames of the unicorn's gallop or walk cycle")
+	flag.IntVar(&turntable, "turntable", 0, "if given, create an animated GIF (or, for PNG or JPEG output, a sprite sheet) with this many frames of the camera circling the unicorn")
+	flag.Func("elevation", "the angle of the camera above the horizon in degrees for -turntable, from -89 to 89; defaults to the angle derived from the hash", func(s string) error {
+		e, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		elevation = &e
+		return nil
+	})
+	flag.IntVar(&columns, "columns", 0, "the number of columns of the sprite sheet created with -turntable; defaults to all frames in a single row")
+	flag.StringVar(&timelinefile, "timeline", "", "if given, render the keyframe animation described by this JSON file as a numbered sequence of images")
+	flag.StringVar(&y4mfile, "y4m", "", "if given along with -timeline, the frames are also written to this file as an uncompressed Y4M video")
 
 	flag.Parse()
 	inputs := 0
 	if mail != "" {
 		inputs++
 	}
+	if id != "" {
+		inputs++
+	}
 	if hash != "" {
 		inputs++
 	}
 	if random {
 		inputs++
 	}
+	if datain != "" {
+		inputs++
+	}
 	if inputs == 0 {
-		os.Stderr.WriteString("Must specify an email (via -m), a hash (via -h), or random generation (via -r)\n")
+		os.Stderr.WriteString("Must specify an email (via -m), an identifier (via -id), a hash (via -h), random generation (via -r), or a data file (via -datain)\n")
 		os.Exit(1)
 	}
 	if inputs > 1 {
-		os.Stderr.WriteString("Cannot specify more than one of -m, -h, and -r.\n")
+		os.Stderr.WriteString("Cannot specify more than one of -m, -id, -h, -r, and -datain.\n")
 		os.Exit(1)
 	}
-	if size <= 0 {
-		os.Stderr.WriteString("Size (argument to -s) must be a positive number")
+	if msg := rf.check(); msg != "" {
+		os.Stderr.WriteString(msg + "\n")
+		os.Exit(1)
+	}
+	if animate < 0 {
+		os.Stderr.WriteString("Frame count (argument to -animate) must be a positive number\n")
+		os.Exit(1)
+	}
+	if turntable < 0 {
+		os.Stderr.WriteString("Frame count (argument to -turntable) must be a positive number\n")
+		os.Exit(1)
+	}
+	if animate > 0 && turntable > 0 {
+		os.Stderr.WriteString("Cannot specify both -animate and -turntable\n")
+		os.Exit(1)
+	}
+	if (animate > 0 || turntable > 0) && (depthfile != "" || normalfile != "" || maskfile != "") {
+		os.Stderr.WriteString("Cannot create a depth map, normal map, or mask for an animation\n")
+		os.Exit(1)
+	}
+	if turntable == 0 && (elevation != nil || columns != 0) {
+		os.Stderr.WriteString("-elevation and -columns can only be used with -turntable\n")
+		os.Exit(1)
+	}
+	if elevation != nil && (*elevation < -89 || *elevation > 89) {
+		os.Stderr.WriteString("Elevation (argument to -elevation) must be between -89 and 89\n")
+		os.Exit(1)
+	}
+	if columns < 0 {
+		os.Stderr.WriteString("Number of columns (argument to -columns) must be a positive number\n")
+		os.Exit(1)
+	}
+
+	var timeline *unicornify.Timeline
+	if timelinefile != "" {
+		if animate > 0 || turntable > 0 {
+			os.Stderr.WriteString("Cannot combine -timeline with -animate or -turntable\n")
+			os.Exit(1)
+		}
+		if depthfile != "" || normalfile != "" || maskfile != "" || meshfile != "" {
+			os.Stderr.WriteString("Cannot create a depth map, normal map, mask, or mesh for a timeline animation\n")
+			os.Exit(1)
+		}
+		if outfile == "-" {
+			os.Stderr.WriteString("Cannot write the frames of a timeline animation to stdout\n")
+			os.Exit(1)
+		}
+		f, err := os.Open(timelinefile)
+		if err != nil {
+			os.Stderr.WriteString("Could not read timeline file " + timelinefile + "\n")
+			os.Exit(1)
+		}
+		timeline, err = unicornify.ParseTimeline(f)
+		f.Close()
+		if err != nil {
+			os.Stderr.WriteString("Timeline file " + timelinefile + " is not valid: " + err.Error() + "\n")
+			os.Exit(1)
+		}
+	} else if y4mfile != "" {
+		os.Stderr.WriteString("A Y4M video (-y4m) can only be created for a timeline animation (-timeline)\n")
+		os.Exit(1)
+	}
+
+	var meshFormat unicornify.MeshFormat
+	if meshfile != "" {
+		f, err := unicornify.ParseMeshFormat(filepath.Ext(meshfile))
+		if err != nil {
+			os.Stderr.WriteString("Mesh file name (argument to -meshout) must end in .stl, .obj, or .gltf\n")
+			os.Exit(1)
+		}
+		meshFormat = f
+		if meshres < 2 {
+			os.Stderr.WriteString("Mesh resolution (argument to -meshres) must be at least 2\n")
+			os.Exit(1)
+		}
+	}
+
+	alg, err := unicornify.ParseHashAlgorithm(hashAlg)
+	if err != nil {
+		os.Stderr.WriteString("Unknown hash algorithm (argument to -hashalg) " + hashAlg + "; must be md5 or sha256\n")
 		os.Exit(1)
 	}
 
 	if random {
 		hash = randomHash()
 	} else if mail != "" {
-		hash = mail2hash(mail)
+		hash = unicornify.HashEmail(mail, alg)
+	} else if id != "" {
+		if unicornify.NormalizeID(id) == "" {
+			os.Stderr.WriteString("Identifier (argument to -id) must not be empty\n")
+			os.Exit(1)
+		}
+		hash = unicornify.HashID(id)
+	}
+
+	var inData unicornify.AllData
+	name := hash
+	if datain != "" {
+		content, err := os.ReadFile(datain)
+		if err != nil {
+			os.Stderr.WriteString("Could not read data file " + datain + "\n")
+			os.Exit(1)
+		}
+		err = json.Unmarshal(content, &inData)
+		if err != nil {
+			os.Stderr.WriteString("Data file " + datain + " is not valid: " + err.Error() + "\n")
+			os.Exit(1)
+		}
+		name = strings.TrimSuffix(filepath.Base(datain), filepath.Ext(datain))
+	}
+
+	fallback := unicornify.PNG
+	if animate > 0 || turntable > 0 {
+		fallback = unicornify.GIF
+	}
+	format, msg := ff.resolve(outfile, fallback)
+	if msg != "" {
+		os.Stderr.WriteString(msg + "\n")
+		os.Exit(1)
+	}
+	if animate > 0 && format.Name != "gif" {
+		os.Stderr.WriteString("Animations can only be written as GIF\n")
+		os.Exit(1)
+	}
+	if timeline != nil && format.Name == "svg" {
+		os.Stderr.WriteString("Timeline animations cannot be written as SVG\n")
+		os.Exit(1)
+	}
+	if turntable > 0 && format.Name == "svg" {
+		os.Stderr.WriteString("Turntable animations can be written as GIF, or as a PNG or JPEG sprite sheet\n")
+		os.Exit(1)
+	}
+	if format.Name == "svg" && (depthfile != "" || normalfile != "" || maskfile != "") {
+		os.Stderr.WriteString("Cannot create a depth map, normal map, or mask for an SVG image\n")
+		os.Exit(1)
 	}
 	if outfile == "" {
-		outfile = hash + ".png"
+		outfile = name + "." + format.Extension()
+	}
+	if timeline != nil {
+		// e.g. unicorn.png becomes unicorn-0000.png, unicorn-0001.png, ...
+		digits := len(strconv.Itoa(timeline.Frames - 1))
+		if digits < 4 {
+			digits = 4
+		}
+		ext := filepath.Ext(outfile)
+		base := strings.ReplaceAll(strings.TrimSuffix(outfile, ext), "%", "%%")
+		outfile = fmt.Sprintf("%s-%%0%dd%s", base, digits, strings.ReplaceAll(ext, "%", "%%"))
 	}
 
-	fmt.Printf("Creating size %v avatar for hash %v, writing into %v\n", size, hash, outfile)
-	actualSize := size
-	if !nodouble {
-		actualSize *= 2
+	// when writing the image to stdout, messages go to stderr
+	var messages io.Writer = os.Stdout
+	destination := outfile
+	if outfile == "-" {
+		messages = os.Stderr
+		destination = "stdout"
 	}
 
-	yCallback := func(y int) {
-		perc := (y + 1) * 100 / actualSize
-		fmt.Printf("\r%v%%    ", perc)
+	if timeline != nil {
+		destination = fmt.Sprintf("%v frames %v", timeline.Frames, fmt.Sprintf(outfile, 0))
+		if timeline.Frames > 1 {
+			destination += " to " + fmt.Sprintf(outfile, timeline.Frames-1)
+		}
+	}
+	if datain != "" {
+		fmt.Fprintf(messages, "Creating size %v avatar from data file %v, writing into %v\n", rf.size.String(), datain, destination)
+	} else {
+		fmt.Fprintf(messages, "Creating size %v avatar for hash %v, writing into %v\n", rf.size.String(), hash, destination)
 	}
 
-	err, img, allData := unicornify.MakeAvatar(hash, actualSize, !free, zoomOut, !noshading, !nograss && !free, !serial, yCallback)
-	fmt.Print("\r    \r")
-	if err != nil {
-		os.Stderr.WriteString("Not a valid hexadecimal number: " + hash + "\n")
-		os.Exit(1)
+	opts := rf.options()
+	opts.Progress = func(done, total int) {
+		fmt.Fprintf(messages, "\r%v%%    ", done*100/total)
+	}
+	if serial {
+		opts.Concurrency = 1
+	}
+	if elevation != nil {
+		// like -pose, this comes first so -set can still change it
+		opts.Overrides = append([]unicornify.Override{{Field: "XAngle", Value: *elevation}}, opts.Overrides...)
+	}
+	var depth *image.Gray16
+	if depthfile != "" {
+		opts.DepthMap = func(d *image.Gray16) {
+			depth = d
+		}
+	}
+	var normals *image.NRGBA
+	if normalfile != "" {
+		opts.NormalMap = func(n *image.NRGBA) {
+			normals = n
+		}
 	}
 
-	if !nodouble {
-		img = downscale(img)
+	var mask *image.Paletted
+	if maskfile != "" {
+		opts.SegmentationMask = func(m *image.Paletted) {
+			mask = m
+		}
 	}
 
-	f, err := os.Create(outfile)
+	var img *image.NRGBA
+	var frames []*image.NRGBA
+	var svg []byte
+	var allData unicornify.AllData
+	ctx := context.Background()
+	if timeline != nil {
+		var video *unicornify.Y4MWriter
+		var videoFile *os.File
+		if y4mfile != "" {
+			videoFile, err = os.Create(y4mfile)
+			if err != nil {
+				os.Stderr.WriteString("Could not create video file " + y4mfile + "\n")
+				os.Exit(1)
+			}
+			video = unicornify.NewY4MWriter(videoFile, timeline.FPS)
+		}
+		writeFrame := func(i int, img *image.NRGBA, data unicornify.AllData) error {
+			filename := fmt.Sprintf(outfile, i)
+			f, err := os.Create(filename)
+			if err != nil {
+				return fmt.Errorf("could not create output file %v", filename)
+			}
+			buf := bufio.NewWriter(f)
+			// the hash alone doesn't describe the frame, so the metadata
+			// always includes the data
+			err = ff.encode(buf, img, format, "", opts, data)
+			if err == nil {
+				err = buf.Flush()
+			}
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil && video != nil {
+				err = video.WriteFrame(img)
+			}
+			if err != nil {
+				return fmt.Errorf("error writing frame %v: %v", i, err)
+			}
+			return nil
+		}
+		if datain != "" {
+			allData, err = unicornify.RenderTimelineFromData(ctx, inData, timeline, opts, writeFrame)
+		} else {
+			allData, err = unicornify.RenderTimeline(ctx, hash, timeline, opts, writeFrame)
+		}
+		fmt.Fprint(messages, "\r    \r")
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		if videoFile != nil {
+			// the last frame may only reach the disk when closing
+			if err := videoFile.Close(); err != nil {
+				os.Stderr.WriteString("Error writing video file " + y4mfile + "\n")
+				os.Exit(1)
+			}
+		}
+		if datafile != "" {
+			writeData(datafile, allData)
+		}
+		return
+	}
+	if format.Name == "svg" {
+		if datain != "" {
+			svg, allData, err = unicornify.RenderSVGFromData(ctx, inData, opts)
+		} else {
+			svg, allData, err = unicornify.RenderSVG(ctx, hash, opts)
+		}
+	} else if datain != "" {
+		if animate > 0 {
+			frames, allData, err = unicornify.RenderAnimationFromData(ctx, inData, animate, opts)
+		} else if turntable > 0 {
+			frames, allData, err = unicornify.RenderTurntableFromData(ctx, inData, turntable, opts)
+		} else {
+			img, allData, err = unicornify.RenderNRGBAFromData(ctx, inData, opts)
+		}
+	} else if turntable > 0 {
+		frames, allData, err = unicornify.RenderTurntable(ctx, hash, turntable, opts)
+	} else if animate > 0 {
+		frames, allData, err = unicornify.RenderAnimation(ctx, hash, animate, opts)
+	} else {
+		img, allData, err = unicornify.RenderNRGBA(ctx, hash, opts)
+	}
+	fmt.Fprint(messages, "\r    \r")
 	if err != nil {
-		os.Stderr.WriteString("Could not create output file " + outfile + "\n")
+		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
 	}
 
-	defer f.Close()
+	f := os.Stdout
+	if outfile != "-" {
+		f, err = os.Create(outfile)
+		if err != nil {
+			os.Stderr.WriteString("Could not create output file " + outfile + "\n")
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
 	buf := bufio.NewWriter(f)
-	png.Encode(buf, img)
-	err = buf.Flush()
+	if format.Name == "svg" {
+		_, err = buf.Write(svg)
+	} else if turntable > 0 && format.Name != "gif" {
+		err = unicornify.Encode(buf, unicornify.MakeSpriteSheet(frames, columns), format)
+	} else if turntable > 0 {
+		// one turn in four seconds
+		delay := 400 / turntable
+		if delay < 2 {
+			delay = 2
+		}
+		err = gif.EncodeAll(buf, unicornify.MakeGIF(frames, delay))
+	} else if animate > 0 {
+		// one cycle per second
+		delay := 100 / animate
+		if delay < 2 {
+			delay = 2
+		}
+		err = gif.EncodeAll(buf, unicornify.MakeGIF(frames, delay))
+	} else {
+		err = ff.encode(buf, img, format, hash, opts, allData)
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
 	if err != nil {
 		os.Stderr.WriteString("Error writing to output file\n")
 		os.Exit(1)
 	}
 
-	if datafile != "" {
-		json, err := json.MarshalIndent(allData, "", "  ")
-		if err != nil {
-			os.Stderr.WriteString("Error creating content for data file\n")
-			os.Stderr.WriteString(err.Error())
-
+	if depthfile != "" {
+		if err := writePNG(depthfile, depth); err != nil {
+			os.Stderr.WriteString("Error writing depth map file\n")
+			os.Exit(1)
+		}
+	}
+	if normalfile != "" {
+		if err := writePNG(normalfile, normals); err != nil {
+			os.Stderr.WriteString("Error writing normal map file\n")
 			os.Exit(1)
 		}
-		err = os.WriteFile(datafile, json, 0o644)
+	}
+	if maskfile != "" {
+		if err := writePNG(maskfile, mask); err != nil {
+			os.Stderr.WriteString("Error writing mask file\n")
+			os.Exit(1)
+		}
+		legend, _ := json.MarshalIndent(unicornify.MaskLegend(), "", "  ")
+		legendfile := strings.TrimSuffix(maskfile, filepath.Ext(maskfile)) + ".json"
+		if err := os.WriteFile(legendfile, legend, 0o644); err != nil {
+			os.Stderr.WriteString("Error writing mask legend file\n")
+			os.Exit(1)
+		}
+	}
+
+	if meshfile != "" {
+		// allData already has the overrides applied; applying them again
+		// doesn't change it, but keeps the mesh right should that change
+		mesh, err := unicornify.RenderMeshFromData(ctx, allData, unicornify.MeshOptions{Resolution: meshres, Overrides: opts.Overrides})
+		if err == nil {
+			err = writeMesh(meshfile, mesh, meshFormat)
+		}
 		if err != nil {
-			os.Stderr.WriteString("Error writing data file\n")
+			os.Stderr.WriteString("Error writing mesh file: " + err.Error() + "\n")
 			os.Exit(1)
 		}
 	}
+
+	if datafile != "" {
+		writeData(datafile, allData)
+	}
+}
+
+// writeData writes the unicorn data to a JSON file, exiting on errors.
+func writeData(filename string, allData unicornify.AllData) {
+	json, err := json.MarshalIndent(allData, "", "  ")
+	if err != nil {
+		os.Stderr.WriteString("Error creating content for data file\n")
+		os.Stderr.WriteString(err.Error())
+
+		os.Exit(1)
+	}
+	err = os.WriteFile(filename, json, 0o644)
+	if err != nil {
+		os.Stderr.WriteString("Error writing data file\n")
+		os.Exit(1)
+	}
 }
 
-func mail2hash(mail string) string {
-	mail = strings.ToLower(strings.TrimSpace(mail))
-	mailbytes := make([]byte, len(mail))
-	copy(mailbytes, mail)
-	md5sum := md5.Sum(mailbytes)
-	return hex.EncodeToString(md5sum[:])
+func writePNG(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(f)
+	err = png.Encode(buf, img)
+	if err == nil {
+		err = buf.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeMesh(filename string, mesh *unicornify.Mesh, format unicornify.MeshFormat) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = mesh.Write(f, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 func randomHash() string {
@@ -141,22 +540,3 @@ func randomHash() string {
 	}
 	return hex.EncodeToString(b)
 }
-
-func downscale(img *image.RGBA) *image.RGBA {
-	origsize := img.Bounds().Dx()
-
-	result := image.NewRGBA(image.Rect(0, 0, origsize/2, origsize/2))
-
-	inpix := img.Pix
-	outpix := result.Pix
-
-	for y := 0; y < origsize/2; y++ {
-		for x := 0; x < origsize*2; x++ {
-			inpos := (x/4)*8 + x%4 + y*2*img.Stride
-			v := uint32(inpix[inpos]) + uint32(inpix[inpos+4]) + uint32(inpix[inpos+img.Stride]) + uint32(inpix[inpos+img.Stride+4])
-			outpix[x+y*result.Stride] = uint8(v / 4)
-		}
-	}
-	return result
-
-}
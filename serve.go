@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/balpha/go-unicornify/unicornify"
+)
+
+func serve(args []string) {
+	var addr string
+	var maxSize int
+
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&addr, "addr", ":8080", "the address to listen on")
+	flags.IntVar(&maxSize, "maxsize", 2048, "the maximum size in pixels that can be requested")
+	flags.Parse(args)
+
+	if maxSize <= 0 {
+		os.Stderr.WriteString("Maximum size (argument to -maxsize) must be a positive number\n")
+		os.Exit(1)
+	}
+
+	handler := unicornify.NewAvatarHandler()
+	handler.MaxSize = maxSize
+	if handler.DefaultSize > maxSize {
+		handler.DefaultSize = maxSize
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/avatar/", handler)
+
+	fmt.Printf("Serving unicorn avatars on %v\n", addr)
+	err := http.ListenAndServe(addr, mux)
+	os.Stderr.WriteString(err.Error() + "\n")
+	os.Exit(1)
+}
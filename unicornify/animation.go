@@ -0,0 +1,87 @@
+package unicornify
+
+import (
+	"context"
+	"errors"
+	"image"
+)
+
+// RenderAnimation renders frameCount frames of the unicorn's gallop (or walk)
+// cycle, sweeping the pose phase from 0 to 1 while keeping everything else
+// as determined by the hash. Since the cycle is periodic, the frames can be
+// played in a loop. The returned AllData is that of the first frame.
+func RenderAnimation(ctx context.Context, hash string, frameCount int, opts Options) ([]*image.NRGBA, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	allData, err := randomize(hash, opts.ZoomOut)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	allData.UnicornData.PosePhase = 0
+	if err := allData.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	frames, err := renderAnimation(ctx, allData, frameCount, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return frames, allData, nil
+}
+
+// RenderAnimationFromData is like RenderAnimation, but for the unicorn
+// described by data. The pose phase in data is used for the first frame. The
+// returned AllData is that of the first frame, with the overrides in opts
+// applied.
+func RenderAnimationFromData(ctx context.Context, data AllData, frameCount int, opts Options) ([]*image.NRGBA, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if opts.ZoomOut {
+		data.Scale = .5
+	}
+	frames, err := renderAnimation(ctx, data, frameCount, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return frames, data, nil
+}
+
+func renderAnimation(ctx context.Context, allData AllData, frameCount int, opts Options) ([]*image.NRGBA, error) {
+	if frameCount <= 0 {
+		return nil, errors.New("frame count must be a positive number")
+	}
+	startPhase := allData.UnicornData.PosePhase
+
+	r := newRenderer(opts)
+	frames := make([]*image.NRGBA, frameCount)
+	for i := range frames {
+		frameData := allData
+		frameData.UnicornData.PosePhase = startPhase + float64(i)/float64(frameCount)
+
+		r.opts.Progress = frameProgress(opts.Progress, i, frameCount)
+		var err error
+		frames[i], err = r.render(ctx, frameData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return frames, nil
+}
+
+// frameProgress turns the progress callback for a whole animation into one
+// for a single frame; it returns nil if progress is nil.
+func frameProgress(progress func(done, total int), frame, frameCount int) func(done, total int) {
+	if progress == nil {
+		return nil
+	}
+	return func(done, total int) {
+		progress(frame*total+done, frameCount*total)
+	}
+}
@@ -1,8 +1,14 @@
 package unicornify
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"image"
+	"image/draw"
 	"math"
+	"reflect"
+	"runtime"
 
 	. "github.com/balpha/go-unicornify/unicornify/core"
 	. "github.com/balpha/go-unicornify/unicornify/elements"
@@ -18,13 +24,273 @@ type AllData struct {
 	XAngle         float64
 	YAngle         float64
 	FocalLength    float64
+	LightDirection Vector
 }
 
+// defaultLightDirection is used for data that was created before the light
+// direction became part of AllData.
+var defaultLightDirection = Vector{1.5, 10, 0}
+
+// Options control how Render draws a unicorn avatar. Use DefaultOptions to
+// get the settings the command line tool uses when no flags are given.
+type Options struct {
+	// Size is the width (and height) of the resulting image in pixels.
+	Size int
+
+	// Width and Height, if both are set, are used instead of Size to
+	// create an image that isn't square. The unicorn is framed according
+	// to the smaller of the two.
+	Width, Height int
+
+	// Background determines whether sky, land, rainbow and clouds are drawn.
+	// Without a background, the unicorn is drawn onto a transparent image.
+	Background bool
+
+	// ZoomOut makes sure the whole unicorn is visible, rather than possibly
+	// only its head.
+	ZoomOut bool
+
+	// Shading adds light and shadows; without it, unicorns look flatter.
+	Shading bool
+
+	// Grass adds grass to the ground. It is usually only wanted together
+	// with Background.
+	Grass bool
+
+	// Concurrency is the number of goroutines used for drawing. Zero means
+	// runtime.NumCPU(), one means the image is drawn serially.
+	Concurrency int
+
+	// Antialiasing is the supersampling factor, i.e. the image is rendered
+	// at this multiple of Size and then scaled down using Filter. One means
+	// no antialiasing; the other supported factors are 2, 3, 4, and 8.
+	Antialiasing int
+
+	// Filter is used for scaling down the supersampled image.
+	Filter Filter
+
+	// LinearLight makes color gradients and the scaling down for
+	// antialiasing work in linear light instead of directly on the sRGB
+	// values. This avoids darkened edges between saturated colors; without
+	// it, the result is identical to earlier versions.
+	LinearLight bool
+
+	// Progress, if not nil, is called repeatedly while drawing, with the
+	// number of rows done so far and the total number of rows (which, due
+	// to antialiasing, may be larger than Size).
+	Progress func(done, total int) `json:"-"`
+
+	// DepthMap, if not nil, is called after rendering with a 16-bit
+	// grayscale image of the same size that shows the depth of the unicorn
+	// (and grass). The values are normalized so that the nearest point is
+	// 65535 and the farthest is 1; the background is 0. When rendering an
+	// animation, it is called for each frame in order.
+	DepthMap func(depth *image.Gray16) `json:"-"`
+
+	// NormalMap, if not nil, is called after rendering with an image of the
+	// same size that encodes the surface normals in camera space, using the
+	// usual 0.5+0.5n encoding (red is right, green is up, blue is towards
+	// the viewer). Alpha is the coverage; the background is transparent.
+	// When rendering an animation, it is called for each frame in order.
+	NormalMap func(normals *image.NRGBA) `json:"-"`
+
+	// SegmentationMask, if not nil, is called after rendering with an
+	// indexed image of the same size that shows which part of the scene
+	// (horn, mane, grass, sky, ...) each pixel belongs to. The palette is
+	// MaskPalette, and MaskLegend describes the indices. When rendering an
+	// animation, it is called for each frame in order.
+	SegmentationMask func(mask *image.Paletted) `json:"-"`
+
+	// Overrides are applied to the data after it has been derived from the
+	// hash (or, for RenderFromData, to the given data).
+	Overrides []Override
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Size:         256,
+		Background:   true,
+		Shading:      true,
+		Grass:        true,
+		Antialiasing: 2,
+	}
+}
+
+// MakeAvatar renders the unicorn for the given hash without antialiasing.
+// It is kept for compatibility; new code should use Render.
 func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shading bool, grass bool, parallelize bool, yCallback func(int)) (error, *image.RGBA, AllData) {
+	opts := Options{
+		Size:         size,
+		Background:   withBackground,
+		ZoomOut:      zoomOut,
+		Shading:      shading,
+		Grass:        grass,
+		Antialiasing: 1,
+	}
+	if !parallelize {
+		opts.Concurrency = 1
+	}
+	if yCallback != nil {
+		opts.Progress = func(done, total int) {
+			yCallback(done - 1)
+		}
+	}
+	img, allData, err := Render(context.Background(), hash, opts)
+	return err, img, allData
+}
+
+// Render creates the unicorn avatar for the given hash, which must be a
+// hexadecimal number (usually the MD5 or SHA-256 hash of an email address, see
+// HashEmail). Numbers of any length are accepted, and the same number always
+// gives the same unicorn.
+func Render(ctx context.Context, hash string, opts Options) (*image.RGBA, AllData, error) {
+	img, allData, err := RenderNRGBA(ctx, hash, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return premultiplied(img), allData, nil
+}
+
+// RenderNRGBA is like Render, but returns an image with straight
+// (non-premultiplied) alpha, which is what Encode takes. The partly
+// transparent edges of a free avatar keep their full precision that way.
+func RenderNRGBA(ctx context.Context, hash string, opts Options) (*image.NRGBA, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, AllData{}, err
+	}
+
+	allData, err := randomize(hash, opts.ZoomOut)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	if err := allData.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+
+	img, err := renderData(ctx, allData, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return img, allData, nil
+}
+
+// RenderFromData draws the unicorn described by data, e.g. data that was
+// created by Render and then modified. If opts.ZoomOut is set, it overrides
+// data.Scale. The returned AllData is what was actually drawn, i.e. data with
+// the overrides in opts applied.
+func RenderFromData(ctx context.Context, data AllData, opts Options) (*image.RGBA, AllData, error) {
+	img, data, err := RenderNRGBAFromData(ctx, data, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return premultiplied(img), data, nil
+}
+
+// RenderNRGBAFromData is like RenderFromData, but returns an image with
+// straight alpha (see RenderNRGBA).
+func RenderNRGBAFromData(ctx context.Context, data AllData, opts Options) (*image.NRGBA, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, AllData{}, err
+	}
+	if opts.ZoomOut {
+		data.Scale = .5
+	}
+	img, err := renderData(ctx, data, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return img, data, nil
+}
+
+// premultiplied converts img to premultiplied alpha.
+func premultiplied(img *image.NRGBA) *image.RGBA {
+	result := image.NewRGBA(img.Bounds())
+	draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Src)
+	return result
+}
+
+// validate makes sure the data (which may have been edited by hand) can be
+// rendered.
+func (d *AllData) validate() error {
+	u := d.UnicornData
+	if u.PoseKindIndex < 0 || u.PoseKindIndex >= len(Poses) {
+		return fmt.Errorf("PoseKindIndex must be between 0 and %v", len(Poses)-1)
+	}
+	for j := range u.Joints {
+		if _, err := ParseJoint(string(j)); err != nil {
+			return err
+		}
+	}
+	hairCount := len(u.HairStarts)
+	if len(u.HairGammas) != hairCount || len(u.HairLengths) != hairCount || len(u.HairAngles) != hairCount ||
+		len(u.HairStraightnesses) != hairCount || len(u.HairTipLightnesses) != hairCount {
+		return errors.New("all Hair... lists must have the same length")
+	}
+	bg := d.BackgroundData
+	cloudCount := len(bg.CloudPositions)
+	if len(bg.CloudSizes) != cloudCount || len(bg.CloudLightnesses) != cloudCount {
+		return errors.New("all Cloud... lists must have the same length")
+	}
+	if d.Scale < .5 {
+		return errors.New("Scale must be at least 0.5")
+	}
+	if d.FocalLength <= 0 {
+		return errors.New("FocalLength must be positive")
+	}
+	if d.LightDirection == (Vector{}) {
+		d.LightDirection = defaultLightDirection
+	}
+	if u.HasWings && u.WingSpan == 0 && u.WingFeatherCount == 0 {
+		// The data was created before unicorns could have wings.
+		d.UnicornData.WingHue = u.BodyHue
+		d.UnicornData.WingSat = 20
+		d.UnicornData.WingSpan = 160
+		d.UnicornData.WingLift = 30 * DEGREE
+		d.UnicornData.WingFeatherCount = 9
+	}
+	return nil
+}
+
+func (opts *Options) validate() error {
+	if opts.Width != 0 || opts.Height != 0 {
+		if opts.Width <= 0 || opts.Height <= 0 {
+			return errors.New("width and height must both be positive numbers")
+		}
+	} else if opts.Size <= 0 {
+		return errors.New("size must be a positive number")
+	}
+	if opts.Antialiasing == 0 {
+		opts.Antialiasing = 1
+	}
+	switch opts.Antialiasing {
+	case 1, 2, 3, 4, 8:
+	default:
+		return fmt.Errorf("unsupported antialiasing factor %v; must be 1, 2, 3, 4, or 8", opts.Antialiasing)
+	}
+	if opts.Filter < BoxFilter || opts.Filter > LanczosFilter {
+		return fmt.Errorf("unknown filter %v", opts.Filter)
+	}
+	return nil
+}
+
+// randomize derives all the unicorn's data from the hash.
+func randomize(hash string, zoomOut bool) (AllData, error) {
 	rand := pyrand.NewRandom()
 	err := rand.SeedFromHexString(hash)
 	if err != nil {
-		return err, nil, AllData{}
+		return AllData{}, fmt.Errorf("not a valid hexadecimal number: %v", hash)
 	}
 
 	data := UnicornData{}
@@ -46,7 +312,6 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 	abs := rand.RandInt(10, 75)
 	yAngle := float64(90+sign*abs) * DEGREE
 	xAngle := float64(rand.RandInt(-20, 20)) * DEGREE
-	originalXAngle := xAngle
 
 	data.Randomize2(rand)
 	bgdata.Randomize2(rand)
@@ -64,6 +329,7 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 	lightDirection = Vector{lightDirection.Z(), lightDirection.Y(), -lightDirection.X()}
 
 	data.Randomize5(rand)
+	data.Randomize6(rand)
 
 	// end randomization
 
@@ -76,6 +342,43 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 		data.NeckTilt *= -1
 		data.FaceTilt *= -1
 	}
+
+	allData := AllData{
+		UnicornData:    data,
+		BackgroundData: bgdata,
+		GrassData:      grassdata,
+		Scale:          unicornScaleFactor,
+		XAngle:         xAngle,
+		YAngle:         yAngle,
+		FocalLength:    focalLength,
+		LightDirection: lightDirection,
+	}
+	return allData, nil
+}
+
+// scene is everything needed to draw a unicorn: the unicorn itself (already
+// posed and rotated), the camera, and where it ends up on the image.
+type scene struct {
+	data   AllData
+	uni    *Unicorn
+	wv     WorldView
+	shift  Point2d
+	scale  float64
+	width  int
+	height int
+}
+
+// dimensions returns the width and height of the resulting image.
+func (opts Options) dimensions() (int, int) {
+	if opts.Width != 0 || opts.Height != 0 {
+		return opts.Width, opts.Height
+	}
+	return opts.Size, opts.Size
+}
+
+// poseUnicorn creates the unicorn described by data. For the walk pose, the
+// unicorn is rotated so that its front and back hooves are level.
+func poseUnicorn(data UnicornData) *Unicorn {
 	uni := NewUnicorn(data)
 
 	if data.PoseKindIndex == 1 /*Walk*/ {
@@ -92,7 +395,13 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 			b.RotateAround(*uni.Shoulder, -angle, 2)
 		}
 	}
+	return uni
+}
 
+func newScene(allData AllData, width, height int) *scene {
+	uni := poseUnicorn(allData.UnicornData)
+
+	xAngle, yAngle := allData.XAngle, allData.YAngle
 	if xAngle < 0 {
 		for b := range uni.BallSet() {
 			b.RotateAround(*uni.Shoulder, yAngle, 1)
@@ -102,7 +411,10 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 		xAngle = 0
 	}
 
-	fsize := float64(size)
+	fwidth, fheight := float64(width), float64(height)
+	fsize := math.Min(fwidth, fheight)
+	unicornScaleFactor := allData.Scale
+	focalLength := allData.FocalLength
 
 	// factor = 1 means center the head at (1/2, 1/3); factor = 0 means
 	// center the shoulder at (1/2, 1/2)
@@ -116,20 +428,121 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 		LookAtPoint:    lookAtPoint,
 		FocalLength:    focalLength,
 	}
-	Shift := Point2d{0.5 * fsize, factor*fsize/3 + (1-factor)*fsize/2}
-	Scale := ((unicornScaleFactor-0.5)/2.5*2 + 0.5) * fsize / 140.0
-
 	wv.Init()
 
-	img := image.NewRGBA(image.Rect(0, 0, size, size))
-	if withBackground {
-		bgdata.Draw(img, shading)
+	return &scene{
+		data:   allData,
+		uni:    uni,
+		wv:     wv,
+		shift:  Point2d{0.5 * fwidth, factor*fheight/3 + (1-factor)*fheight/2},
+		scale:  ((unicornScaleFactor-0.5)/2.5*2 + 0.5) * fsize / 140.0,
+		width:  width,
+		height: height,
+	}
+}
+
+// prepare fills in the parts of the data that are derived from other parts.
+func (d *AllData) prepare() {
+	d.UnicornData.PoseKind = Poses[d.UnicornData.PoseKindIndex]
+	bgdata := d.BackgroundData
+	d.GrassData.Horizon = bgdata.Horizon
+	d.GrassData.Color1 = bgdata.Color("Land", bgdata.LandLight)
+	d.GrassData.Color2 = bgdata.Color("Land", bgdata.LandLight/2)
+}
+
+// renderData draws the unicorn described by allData according to opts; both
+// must have been validated.
+func renderData(ctx context.Context, allData AllData, opts Options) (*image.NRGBA, error) {
+	return newRenderer(opts).render(ctx, allData)
+}
+
+// A renderer draws unicorns with fixed options. It keeps the background (and
+// its part of the segmentation mask), so that drawing many frames of an
+// animation only draws it again if the background data changes.
+type renderer struct {
+	opts          Options
+	width, height int // including antialiasing
+
+	bgdata     *BackgroundData // what background and bgmask were made from
+	background *image.RGBA
+	bgmask     []Part
+}
+
+// newRenderer returns a renderer for the given options, which must have been
+// validated.
+func newRenderer(opts Options) *renderer {
+	width, height := opts.dimensions()
+	return &renderer{
+		opts:   opts,
+		width:  width * opts.Antialiasing,
+		height: height * opts.Antialiasing,
+	}
+}
+
+// prepareBackground makes sure the background matches bgdata.
+func (r *renderer) prepareBackground(ctx context.Context, bgdata BackgroundData) error {
+	if r.bgdata != nil && reflect.DeepEqual(*r.bgdata, bgdata) {
+		return nil
+	}
+	r.bgdata = nil
+	r.background = image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	bgdata.Draw(r.background, r.opts.Shading, r.opts.LinearLight)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.bgmask = nil
+	if r.opts.SegmentationMask != nil {
+		r.bgmask = bgdata.mask(r.width, r.height)
+	}
+	r.bgdata = &bgdata
+	return nil
+}
+
+// render draws the unicorn described by allData, which must have been
+// validated.
+func (r *renderer) render(ctx context.Context, allData AllData) (*image.NRGBA, error) {
+	opts := r.opts
+	allData.prepare()
+
+	width, height := r.width, r.height
+	sc := newScene(allData, width, height)
+	sc.wv.LinearLight = opts.LinearLight
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if opts.Background {
+		if err := r.prepareBackground(ctx, allData.BackgroundData); err != nil {
+			return nil, err
+		}
+		copy(img.Pix, r.background.Pix)
+	}
+
+	var gb *GBuffer
+	if opts.DepthMap != nil || opts.NormalMap != nil || opts.SegmentationMask != nil {
+		gb = NewGBuffer(img.Bounds())
+	}
+	if err := sc.draw(ctx, img, gb, opts); err != nil {
+		return nil, err
 	}
 
-	scaleAndShift := func(t Tracer) Tracer {
-		t = NewScalingTracer(wv, t, Scale)
-		return NewTranslatingTracer(wv, t, Shift[0], Shift[1])
+	if opts.DepthMap != nil {
+		opts.DepthMap(depthMap(gb, opts.Antialiasing))
+	}
+	if opts.NormalMap != nil {
+		opts.NormalMap(normalMap(gb, opts.Antialiasing))
+	}
+	if opts.SegmentationMask != nil {
+		var background []Part
+		if opts.Background {
+			background = r.bgmask
+		}
+		opts.SegmentationMask(segmentationMask(gb, background, opts.Antialiasing))
 	}
+	return Resample(img, opts.Antialiasing, opts.Filter, opts.LinearLight), nil
+}
+
+func (sc *scene) tracer(grass, shading bool) Tracer {
+	uni, wv, bgdata := sc.uni, sc.wv, sc.data.BackgroundData
+	Shift, Scale := sc.shift, sc.scale
 
 	uniAndMaybeGrass := &Figure{}
 	uniAndMaybeGrass.Add(uni)
@@ -144,22 +557,43 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 		floory := ymaxhoof + uni.Legs[0].Hoof.Radius
 
 		hx := (0 - Shift[0]) / Scale
-		hy := (bgdata.Horizon*float64(size) - Shift[1]) / Scale
+		hy := (bgdata.Horizon*float64(sc.height) - Shift[1]) / Scale
 		var hdist float64 = 100
 		for wv.UnProject(Vector{hx, hy, hdist}).Y() < floory {
 			hdist += 10
 		}
-		grassSandwich := GrassSandwich(floory, bgdata, grassdata, Shift, Scale, size)
+		grassSandwich := GrassSandwich(floory, bgdata, sc.data.GrassData, Shift, Scale, sc.width, wv.LinearLight)
 
 		// center can't be exactly the camera position -- haven't yet dug into where exactly this is creating edge case behavior
 		crop := NewBallP(wv.CameraPosition.Plus(Vector{0, 0, 1}), hdist, Color{255, 0, 0})
 
-		uniAndMaybeGrass.Add(NewIntersection(grassSandwich, crop))
+		var grassThing Thing = NewIntersection(grassSandwich, crop)
+
+		// The crop is measured at the edge of the image, the column farthest
+		// from the camera axis, so the grass reaches the horizon everywhere;
+		// closer to the axis, it rises slightly above it. On square images,
+		// that's how unicorns have always looked, so they're left alone; on
+		// wider ones, the bulge gets large, so the grass is also cut off at
+		// the plane through the camera and the horizon of the background.
+		if sc.width != sc.height {
+			horizon := (float64(int(bgdata.Horizon*float64(sc.height))) - .5 - Shift[1]) / Scale
+			p1 := wv.UnProject(Vector{0, horizon, 100}).Minus(wv.CameraPosition)
+			p2 := wv.UnProject(Vector{100, horizon, 100}).Minus(wv.CameraPosition)
+			below := wv.UnProject(Vector{0, horizon + 100, 100}).Minus(wv.CameraPosition)
+			normal := p1.CrossProd(p2)
+			if normal.ScalarProd(below) < 0 {
+				normal = normal.Neg()
+			}
+			grassThing = NewIntersection(grassThing, NewHalfSpace(wv.CameraPosition, normal))
+		}
+
+		uniAndMaybeGrass.Add(grassThing)
 	}
 
 	tracer := uniAndMaybeGrass.GetTracer(wv)
 
 	if shading {
+		lightDirection := sc.data.LightDirection
 		p := Vector{0, 0, 1000}
 		pp := wv.ProjectSphere(p, 0).CenterCS
 		ldp := wv.ProjectSphere(p.Plus(lightDirection), 0).CenterCS.Minus(pp)
@@ -169,27 +603,37 @@ func MakeAvatar(hash string, size int, withBackground bool, zoomOut bool, shadin
 		tracer = sc
 	}
 
-	tracer = scaleAndShift(tracer)
+	tracer = NewScalingTracer(wv, tracer, Scale)
+	return NewTranslatingTracer(wv, tracer, Shift[0], Shift[1])
+}
 
-	if parallelize {
-		parts := size / 128
-		if parts < 8 {
-			parts = 8
-		}
-		DrawTracerParallel(tracer, wv, img, yCallback, parts)
-	} else {
-		DrawTracer(tracer, wv, img, yCallback)
+func (sc *scene) draw(ctx context.Context, img *image.RGBA, gb *GBuffer, opts Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	rows := sc.height
+	tracer := sc.tracer(opts.Grass, opts.Shading)
 
-	allData := AllData{
-		UnicornData:    data,
-		BackgroundData: bgdata,
-		GrassData:      grassdata,
-		Scale:          unicornScaleFactor,
-		XAngle:         originalXAngle,
-		YAngle:         yAngle,
-		FocalLength:    focalLength,
+	var serialCallback, parallelCallback func(int)
+	if opts.Progress != nil {
+		serialCallback = func(y int) {
+			opts.Progress(Min(y+1, rows), rows)
+		}
+		parallelCallback = func(done int) {
+			opts.Progress(Min(done, rows), rows)
+		}
 	}
 
-	return nil, img, allData
+	workers := opts.Concurrency
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > 1 {
+		parts := Max(sc.width, sc.height) / 128
+		if parts < 8 {
+			parts = 8
+		}
+		return DrawTracerParallel(ctx, tracer, sc.wv, img, gb, parallelCallback, parts, workers)
+	}
+	return DrawTracer(ctx, tracer, sc.wv, img, gb, serialCallback)
 }
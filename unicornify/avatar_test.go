@@ -0,0 +1,32 @@
+package unicornify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// TestSquareRenderUnchanged makes sure that default square avatars look
+// exactly as they always did. The checksums are of the pixels of images
+// rendered by the original program with "-s 128".
+func TestSquareRenderUnchanged(t *testing.T) {
+	tests := []struct {
+		hash, sum string
+	}{
+		{"deadbeefdeadbeefdeadbeefdeadbeef", "3fded5bea436a4ddcf3573c4a1d11c2f57e9e2764f82b83875ef44e9ca872d02"},
+		{"7daf6c79d4802916d83f6266e24850af", "d5d0298145b1af1c4c8e4e19f6f294a68e802d3037347e8e1638db8c1031db59"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Size = 128
+		img, _, err := Render(context.Background(), tt.hash, opts)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.hash, err)
+		}
+		sum := sha256.Sum256(img.Pix)
+		if got := hex.EncodeToString(sum[:]); got != tt.sum {
+			t.Errorf("%v: pixel checksum %v, want %v", tt.hash, got, tt.sum)
+		}
+	}
+}
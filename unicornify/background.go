@@ -66,16 +66,22 @@ func (d *BackgroundData) Randomize2(rand *pyrand.Random) {
 	}
 }
 
-func (d BackgroundData) Draw(im *image.RGBA, shading bool) {
-	size := im.Bounds().Dx()
-	fsize := float64(size - 1)
+// Draw draws the background into im. If linear is true, the gradients are
+// computed in linear light.
+func (d BackgroundData) Draw(im *image.RGBA, shading, linear bool) {
+	mix := MixColors
+	if linear {
+		mix = MixColorsLinear
+	}
+	width, height := im.Bounds().Dx(), im.Bounds().Dy()
+	fwidth, fheight := float64(width-1), float64(height-1)
 
 	// sky
 
-	horizonPixels := int(float64(size) * d.Horizon)
+	horizonPixels := int(float64(height) * d.Horizon)
 	for y := 0; y < horizonPixels; y++ {
-		col := MixColors(d.Color("Sky", 60), d.Color("Sky", 10), float64(y)/fsize)
-		for x := 0; x < size; x++ {
+		col := mix(d.Color("Sky", 60), d.Color("Sky", 10), float64(y)/fheight)
+		for x := 0; x < width; x++ {
 			im.SetRGBA(x, y, col.ToRGBA())
 		}
 	}
@@ -85,19 +91,34 @@ func (d BackgroundData) Draw(im *image.RGBA, shading bool) {
 	land1 := d.Color("Land", d.LandLight)
 	land2 := d.Color("Land", d.LandLight/2)
 
-	for x := 0; x < size; x++ {
-		col := MixColors(land1, land2, float64(x)/fsize)
+	for x := 0; x < width; x++ {
+		col := mix(land1, land2, float64(x)/fwidth)
 
-		for y := horizonPixels; y < size; y++ {
+		for y := horizonPixels; y < height; y++ {
 			im.SetRGBA(x, y, col.ToRGBA())
 		}
 	}
 
+	d.drawRainbowAndClouds(im, shading, false)
+}
+
+// drawRainbowAndClouds draws the parts of the background that are in front of
+// sky and land. If forMask is true, the clouds are drawn in unshaded black,
+// which distinguishes them from the rainbow.
+func (d BackgroundData) drawRainbowAndClouds(im *image.RGBA, shading, forMask bool) {
+	width, height := im.Bounds().Dx(), im.Bounds().Dy()
+	fwidth, fheight := float64(width-1), float64(height-1)
+	// sizes are relative to the smaller dimension
+	fsize := math.Min(fwidth, fheight)
+	horizonPixels := int(float64(height) * d.Horizon)
+
 	// rainbow
 
 	bandPixWidth := d.RainbowBandWidth * fsize
-	rainbowCenterX := fsize * (d.RainbowFoot + d.RainbowDir*d.RainbowHeight)
+	// the foot is relative to the width, but the radius to the smaller
+	// dimension, so the rainbow keeps its shape on non-square images
 	outerRadius := d.RainbowHeight * fsize
+	rainbowCenterX := fwidth*d.RainbowFoot + d.RainbowDir*outerRadius
 
 	drawRainbow(im, int(rainbowCenterX+.5), horizonPixels, int(outerRadius+.5), bandPixWidth)
 
@@ -106,8 +127,38 @@ func (d BackgroundData) Draw(im *image.RGBA, shading bool) {
 	for i, pos := range d.CloudPositions {
 
 		sizes := d.CloudSizes[i]
-		drawCloud(im, fsize*pos[0], fsize*pos[1], fsize*sizes[0], fsize*sizes[0]*sizes[1], d.Color("Sky", d.CloudLightnesses[i]), shading)
+		col := d.Color("Sky", d.CloudLightnesses[i])
+		if forMask {
+			col = Black
+		}
+		drawCloud(im, fwidth*pos[0], fheight*pos[1], fsize*sizes[0], fsize*sizes[0]*sizes[1], col, shading && !forMask)
+	}
+}
+
+// mask returns the part of the background (sky, land, rainbow, or cloud) at
+// each pixel of an image of the given size, row by row.
+func (d BackgroundData) mask(width, height int) []Part {
+	scratch := image.NewRGBA(image.Rect(0, 0, width, height))
+	d.drawRainbowAndClouds(scratch, false, true)
+	horizonPixels := int(float64(height) * d.Horizon)
+
+	result := make([]Part, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := scratch.RGBAAt(x, y)
+			switch {
+			case c.A == 0 && y < horizonPixels:
+				result[y*width+x] = PartSky
+			case c.A == 0:
+				result[y*width+x] = PartLand
+			case c.R == 0 && c.G == 0 && c.B == 0:
+				result[y*width+x] = PartCloud
+			default:
+				result[y*width+x] = PartRainbow
+			}
+		}
 	}
+	return result
 }
 
 func between(v, min, max int) int {
@@ -124,11 +175,11 @@ func between(v, min, max int) int {
 }
 
 func drawRainbow(img *image.RGBA, cx, cy, r int, bandWidth float64) {
-	size := img.Bounds().Dx()
-	left := between(cx-r, 0, size-1)
-	right := between(cx+r, 0, size-1)
-	top := between(cy-r, 0, size-1)
-	bottom := between(cy, 0, size-1)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	left := between(cx-r, 0, width-1)
+	right := between(cx+r, 0, width-1)
+	top := between(cy-r, 0, height-1)
+	bottom := between(cy, 0, height-1)
 	innerRadSquared := int(float64(r) - 7*bandWidth)
 
 	bandCols := [7]color.RGBA{}
@@ -31,6 +31,52 @@ func MixColors(c1 Color, c2 Color, f float64) Color {
 		B: MixBytes(c1.B, c2.B, f),
 	}
 }
+
+// MixColorsLinear is like MixColors, but interpolates the linear-light
+// intensities rather than the gamma-encoded sRGB values, which avoids dark
+// fringes when mixing saturated colors.
+func MixColorsLinear(c1 Color, c2 Color, f float64) Color {
+	return Color{
+		R: FromLinear(MixFloats(ToLinear(c1.R), ToLinear(c2.R), f)),
+		G: FromLinear(MixFloats(ToLinear(c1.G), ToLinear(c2.G), f)),
+		B: FromLinear(MixFloats(ToLinear(c1.B), ToLinear(c2.B), f)),
+	}
+}
+
+var linearTable [256]float64
+
+func init() {
+	for i := range linearTable {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			linearTable[i] = v / 12.92
+		} else {
+			linearTable[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+}
+
+// ToLinear converts an sRGB channel value to linear light in [0, 1].
+func ToLinear(b byte) float64 {
+	return linearTable[b]
+}
+
+// FromLinear converts linear light in [0, 1] back to an sRGB channel value.
+func FromLinear(v float64) byte {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return byte(v*255 + .5)
+}
+
 func MixColorsRGBA(c1 color.RGBA, c2 color.RGBA, f float64) color.RGBA {
 	return color.RGBA{
 		R: MixBytes(c1.R, c2.R, f),
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"image"
+	"math"
+)
+
+// A GBuffer receives per-pixel information besides the color while drawing
+// a tracer: the depth, the surface direction, and the part of the traced point.
+type GBuffer struct {
+	Rect   image.Rectangle
+	Depth  []float64 // the z value of each pixel, or +Inf if nothing was hit
+	Normal []Vector  // the direction of each pixel (not normalized), in camera space
+	Part   []Part    // the part of each pixel, or NoPart if nothing was hit
+}
+
+func NewGBuffer(r image.Rectangle) *GBuffer {
+	gb := &GBuffer{
+		Rect:   r,
+		Depth:  make([]float64, r.Dx()*r.Dy()),
+		Normal: make([]Vector, r.Dx()*r.Dy()),
+		Part:   make([]Part, r.Dx()*r.Dy()),
+	}
+	for i := range gb.Depth {
+		gb.Depth[i] = math.Inf(1)
+	}
+	return gb
+}
+
+// Offset returns the index of the pixel (x, y) in the buffer's slices.
+func (gb *GBuffer) Offset(x, y int) int {
+	return (y-gb.Rect.Min.Y)*gb.Rect.Dx() + (x - gb.Rect.Min.X)
+}
+
+func (gb *GBuffer) set(x, y int, r TraceResult) {
+	if !(image.Point{x, y}.In(gb.Rect)) {
+		return
+	}
+	i := gb.Offset(x, y)
+	gb.Depth[i] = r.Z
+	gb.Normal[i] = r.Direction
+	gb.Part[i] = r.Part
+}
@@ -0,0 +1,8 @@
+package core
+
+// A Part identifies which part of the scene a traced point belongs to, e.g.
+// the horn of the unicorn or the grass. The meaning of the values other than
+// NoPart is up to the code building the scene.
+type Part uint8
+
+const NoPart Part = 0
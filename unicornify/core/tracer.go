@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"image"
 	"math"
 )
@@ -8,28 +9,29 @@ import (
 var NoDirection = Vector{0, 0, 0}
 
 type Tracer interface {
-	Trace(x, y float64, ray Vector) (bool, float64, Vector, Color)
+	Trace(x, y float64, ray Vector) (bool, TraceResult)
 	TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals)
 	GetBounds() Bounds
 	Pruned(rp RenderingParameters) Tracer // okay to return nil or self
 }
 
 func DeepifyTrace(t Tracer, x, y float64, ray Vector) (bool, TraceIntervals) {
-	ok, z, dir, col := t.Trace(x, y, ray)
+	ok, r := t.Trace(x, y, ray)
+	end := r
+	end.Z = math.Inf(1)
 	inter := TraceIntervals{TraceInterval{
-		Start: TraceResult{z, dir, col},
-		End:   TraceResult{math.Inf(1), dir, col},
+		Start: r,
+		End:   end,
 	}}
 	return ok, inter
 }
 
-func UnDeepifyTrace(t Tracer, x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func UnDeepifyTrace(t Tracer, x, y float64, ray Vector) (bool, TraceResult) {
 	ok, r := t.TraceDeep(x, y, ray)
 	if ok {
-		first := r[0].Start
-		return true, first.Z, first.Direction, first.Color
+		return true, r[0].Start
 	}
-	return false, 0, NoDirection, Color{}
+	return false, TraceResult{}
 }
 func SimplyPruned(t Tracer, rp RenderingParameters) Tracer {
 	if rp.Contains(t.GetBounds()) {
@@ -38,7 +40,10 @@ func SimplyPruned(t Tracer, rp RenderingParameters) Tracer {
 	return nil
 }
 
-func DrawTracerPartial(t Tracer, wv WorldView, img *image.RGBA, yCallback func(int), bounds image.Rectangle, c chan bool) {
+// DrawTracerPartial draws the part of the image within bounds. If gb is not
+// nil, it also records the depth, direction, and part of every pixel drawn. It checks for
+// cancellation of ctx after every row and returns ctx.Err() if it was canceled.
+func DrawTracerPartial(ctx context.Context, t Tracer, wv WorldView, img *image.RGBA, gb *GBuffer, yCallback func(int), bounds image.Rectangle) error {
 	r := bounds.Intersect(t.GetBounds().ToRect())
 	rp := RenderingParameters{
 		1,
@@ -48,11 +53,17 @@ func DrawTracerPartial(t Tracer, wv WorldView, img *image.RGBA, yCallback func(i
 	pruned := t.Pruned(rp)
 	if pruned != nil {
 		for y := r.Min.Y; y <= r.Max.Y; y++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			for x := r.Min.X; x <= r.Max.X; x++ {
 				fx, fy := float64(x), float64(y)
-				any, _, _, col := pruned.Trace(fx, fy, wv.Ray(fx, fy))
+				any, res := pruned.Trace(fx, fy, wv.Ray(fx, fy))
 				if any {
-					img.SetRGBA(x, y, col.ToRGBA())
+					img.SetRGBA(x, y, res.Color.ToRGBA())
+					if gb != nil {
+						gb.set(x, y, res)
+					}
 				}
 			}
 			if yCallback != nil {
@@ -60,29 +71,57 @@ func DrawTracerPartial(t Tracer, wv WorldView, img *image.RGBA, yCallback func(i
 			}
 		}
 	}
-	if c != nil {
-		c <- true
-	}
+	return ctx.Err()
 }
-func DrawTracer(t Tracer, wv WorldView, img *image.RGBA, yCallback func(int)) {
-	DrawTracerPartial(t, wv, img, yCallback, img.Bounds(), nil)
+
+func DrawTracer(ctx context.Context, t Tracer, wv WorldView, img *image.RGBA, gb *GBuffer, yCallback func(int)) error {
+	return DrawTracerPartial(ctx, t, wv, img, gb, yCallback, img.Bounds())
 }
-func DrawTracerParallel(t Tracer, wv WorldView, img *image.RGBA, yCallback func(int), partsRoot int) {
+
+// DrawTracerParallel splits the image into partsRoot * partsRoot parts and draws
+// them concurrently, using the given number of worker goroutines (or one
+// goroutine per part if workers <= 0). If ctx is canceled, the parts that
+// haven't been started are skipped; DrawTracerParallel always waits for all
+// its goroutines to finish before returning.
+func DrawTracerParallel(ctx context.Context, t Tracer, wv WorldView, img *image.RGBA, gb *GBuffer, yCallback func(int), partsRoot int, workers int) error {
 	full := img.Bounds()
-	c := make(chan bool)
+	c := make(chan error)
 	parts := partsRoot * partsRoot
 	partsLeft := parts
+	if workers <= 0 || workers > parts {
+		workers = parts
+	}
+	rects := make(chan image.Rectangle, parts)
 	for x := 0; x < partsRoot; x++ {
 		for y := 0; y < partsRoot; y++ {
-			r := image.Rect(full.Dx()*x/partsRoot, full.Dy()*y/partsRoot, full.Dx()*(x+1)/partsRoot-1, full.Dy()*(y+1)/partsRoot-1)
-			go DrawTracerPartial(t, wv, img, nil, r, c)
+			rects <- image.Rect(full.Dx()*x/partsRoot, full.Dy()*y/partsRoot, full.Dx()*(x+1)/partsRoot-1, full.Dy()*(y+1)/partsRoot-1)
 		}
 	}
+	close(rects)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for r := range rects {
+				if err := ctx.Err(); err != nil {
+					c <- err
+					continue
+				}
+				c <- DrawTracerPartial(ctx, t, wv, img, gb, nil, r)
+			}
+		}()
+	}
+	var firstErr error
 	for partsLeft > 0 {
-		<-c
+		err := <-c
 		partsLeft--
-		if yCallback != nil {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if yCallback != nil && firstErr == nil {
 			yCallback(full.Dy() * (parts - partsLeft) / parts)
 		}
 	}
+	return firstErr
 }
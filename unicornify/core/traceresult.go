@@ -8,13 +8,14 @@ type TraceResult struct {
 	Z         float64
 	Direction Vector
 	Color     Color
+	Part      Part
 }
 
 type TraceInterval struct {
 	Start, End TraceResult
 }
 
-var EmptyInterval = TraceInterval{TraceResult{0, NoDirection, Color{}}, TraceResult{0, NoDirection, Color{}}}
+var EmptyInterval = TraceInterval{TraceResult{0, NoDirection, Color{}, NoPart}, TraceResult{0, NoDirection, Color{}, NoPart}}
 
 type TraceIntervals []TraceInterval
 
@@ -43,8 +44,9 @@ func (first TraceInterval) Intersect(second TraceInterval) TraceInterval {
 	}
 
 	color := first.Start.Color //fixme?
+	part := first.Start.Part
 
-	return TraceInterval{TraceResult{left.Z, left.Direction, color}, TraceResult{right.Z, right.Direction, color}}
+	return TraceInterval{TraceResult{left.Z, left.Direction, color, part}, TraceResult{right.Z, right.Direction, color, part}}
 }
 
 func (i TraceInterval) IsEmpty() bool {
@@ -97,24 +99,24 @@ func (is TraceIntervals) Invert() TraceIntervals {
 	if len(is) == 0 {
 		return TraceIntervals{
 			TraceInterval{
-				Start: TraceResult{math.Inf(-1), NoDirection, Color{}},
-				End:   TraceResult{math.Inf(1), NoDirection, Color{}},
+				Start: TraceResult{math.Inf(-1), NoDirection, Color{}, NoPart},
+				End:   TraceResult{math.Inf(1), NoDirection, Color{}, NoPart},
 			},
 		}
 	}
 	result := make(TraceIntervals, len(is)+1)
-	prev := TraceResult{math.Inf(-1), is[0].Start.Direction, is[0].Start.Color}
+	prev := TraceResult{math.Inf(-1), is[0].Start.Direction, is[0].Start.Color, is[0].Start.Part}
 	for index, i := range is {
 		n := TraceInterval{
 			Start: prev,
-			End:   TraceResult{i.Start.Z, i.Start.Direction.Neg(), i.Start.Color},
+			End:   TraceResult{i.Start.Z, i.Start.Direction.Neg(), i.Start.Color, i.Start.Part},
 		}
 		result[index] = n
-		prev = TraceResult{i.End.Z, i.End.Direction.Neg(), i.End.Color}
+		prev = TraceResult{i.End.Z, i.End.Direction.Neg(), i.End.Color, i.End.Part}
 	}
 	result[len(is)] = TraceInterval{
 		Start: prev,
-		End:   TraceResult{math.Inf(1), prev.Direction.Neg(), prev.Color},
+		End:   TraceResult{math.Inf(1), prev.Direction.Neg(), prev.Color, prev.Part},
 	}
 	return result
 }
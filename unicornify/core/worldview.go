@@ -8,6 +8,7 @@ type WorldView struct {
 	CameraPosition Vector
 	LookAtPoint    Vector
 	FocalLength    float64
+	LinearLight    bool // mix colors in linear light rather than in sRGB
 	ux, uy, zero   Vector
 	ray            Vector
 }
@@ -72,6 +73,13 @@ func (wv WorldView) ProjectSphere(center Vector, radius float64) SphereProjectio
 
 }
 
+func (wv WorldView) MixColors(c1, c2 Color, f float64) Color {
+	if wv.LinearLight {
+		return MixColorsLinear(c1, c2, f)
+	}
+	return MixColors(c1, c2, f)
+}
+
 func (wv *WorldView) Ray(x, y float64) Vector {
 	return Vector{x, y, wv.FocalLength}.Unit()
 }
@@ -0,0 +1,89 @@
+package unicornify
+
+import (
+	"image"
+	"math"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+)
+
+// depthMap turns the depths recorded in gb into a grayscale image that is
+// smaller by the given factor, taking the nearest depth of each block of
+// pixels. The nearest point of the scene is white (65535), the farthest one
+// is 1, and pixels where nothing was hit (i.e. the background) are 0.
+func depthMap(gb *GBuffer, factor int) *image.Gray16 {
+	w, h := gb.Rect.Dx()/factor, gb.Rect.Dy()/factor
+	result := image.NewGray16(image.Rect(0, 0, w, h))
+
+	depths := make([]float64, w*h)
+	near, far := math.Inf(1), math.Inf(-1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			z := math.Inf(1)
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					z = math.Min(z, gb.Depth[(y*factor+dy)*gb.Rect.Dx()+x*factor+dx])
+				}
+			}
+			depths[y*w+x] = z
+			if !math.IsInf(z, 1) {
+				near = math.Min(near, z)
+				far = math.Max(far, z)
+			}
+		}
+	}
+
+	for i, z := range depths {
+		if math.IsInf(z, 1) {
+			continue
+		}
+		v := 65535.0
+		if far > near {
+			v = 1 + (far-z)/(far-near)*65534
+		}
+		pos := (i/w)*result.Stride + (i%w)*2
+		result.Pix[pos] = uint8(uint16(v+.5) >> 8)
+		result.Pix[pos+1] = uint8(uint16(v + .5))
+	}
+	return result
+}
+
+// normalMap turns the directions recorded in gb into a normal map that is
+// smaller by the given factor, averaging the directions of each block of
+// pixels. The unit normal n is encoded as 0.5+0.5n in the usual OpenGL
+// convention: red points right, green up, and blue towards the viewer. Alpha
+// is the fraction of the block where something was hit.
+func normalMap(gb *GBuffer, factor int) *image.NRGBA {
+	w, h := gb.Rect.Dx()/factor, gb.Rect.Dy()/factor
+	result := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum Vector
+			hits := 0
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					i := (y*factor+dy)*gb.Rect.Dx() + x*factor + dx
+					dir := gb.Normal[i]
+					if math.IsInf(gb.Depth[i], 1) || dir == NoDirection {
+						continue
+					}
+					sum = sum.Plus(dir.Unit())
+					hits++
+				}
+			}
+			if hits == 0 || sum.Length() == 0 {
+				continue
+			}
+			// camera space has y pointing down and z pointing away
+			// from the viewer
+			n := sum.Unit()
+			out := result.Pix[y*result.Stride+x*4:]
+			out[0] = clampByte((0.5 + 0.5*n.X()) * 255)
+			out[1] = clampByte((0.5 - 0.5*n.Y()) * 255)
+			out[2] = clampByte((0.5 - 0.5*n.Z()) * 255)
+			out[3] = uint8(hits * 255 / (factor * factor))
+		}
+	}
+	return result
+}
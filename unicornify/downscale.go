@@ -0,0 +1,249 @@
+package unicornify
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+)
+
+// A Filter determines how an image that was rendered at a multiple of the
+// requested size is scaled down.
+type Filter int
+
+const (
+	// BoxFilter averages each block of pixels.
+	BoxFilter Filter = iota
+	// TentFilter weights pixels linearly by their distance, blending in
+	// neighboring blocks; the result is a little softer than BoxFilter.
+	TentFilter
+	// LanczosFilter uses a three-lobed Lanczos kernel, which gives the
+	// sharpest result.
+	LanczosFilter
+)
+
+var filterNames = []string{"box", "tent", "lanczos"}
+
+func (f Filter) String() string {
+	if f < 0 || int(f) >= len(filterNames) {
+		return fmt.Sprintf("Filter(%d)", int(f))
+	}
+	return filterNames[f]
+}
+
+// ParseFilter returns the filter with the given name ("box", "tent", or
+// "lanczos").
+func ParseFilter(name string) (Filter, error) {
+	for i, n := range filterNames {
+		if n == name {
+			return Filter(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown filter %q; valid filters are box, tent, and lanczos", name)
+}
+
+func (f Filter) MarshalText() ([]byte, error) {
+	if f < 0 || int(f) >= len(filterNames) {
+		return nil, fmt.Errorf("unknown filter %d", int(f))
+	}
+	return []byte(f.String()), nil
+}
+
+func (f *Filter) UnmarshalText(text []byte) error {
+	parsed, err := ParseFilter(string(text))
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// Resample scales img down by the given integer factor using the filter.
+// Width and height of img must be multiples of factor. If linear is true,
+// the colors are averaged in linear light rather than in sRGB.
+//
+// The (premultiplied) colors of img are weighted by their alpha, so that
+// partially covered pixels get the color of what covers them, and the
+// result has straight (non-premultiplied) alpha.
+func Resample(img *image.RGBA, factor int, filter Filter, linear bool) *image.NRGBA {
+	if filter == BoxFilter && !linear {
+		return boxDownscale(img, factor)
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx()/factor, b.Dy()/factor
+	xContribs := contributions(w, b.Dx(), factor, filter)
+	yContribs := contributions(h, b.Dy(), factor, filter)
+
+	// horizontal pass into a float buffer of size w x b.Dy()
+	tmp := make([]float64, w*b.Dy()*4)
+	for y := 0; y < b.Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x, c := range xContribs {
+			var sums [4]float64
+			for i, weight := range c.weights {
+				pos := (c.start + i) * 4
+				a := row[pos+3]
+				if a == 0 {
+					continue
+				}
+				for ch := 0; ch < 3; ch++ {
+					if linear {
+						sums[ch] += premultipliedToLinear(row[pos+ch], a) * weight
+					} else {
+						sums[ch] += float64(row[pos+ch]) * weight
+					}
+				}
+				sums[3] += float64(a) * weight
+			}
+			copy(tmp[(y*w+x)*4:], sums[:])
+		}
+	}
+
+	// vertical pass
+	result := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y, c := range yContribs {
+		for x := 0; x < w; x++ {
+			var sums [4]float64
+			for i, weight := range c.weights {
+				pos := ((c.start+i)*w + x) * 4
+				for ch := 0; ch < 4; ch++ {
+					sums[ch] += tmp[pos+ch] * weight
+				}
+			}
+			out := result.Pix[y*result.Stride+x*4:]
+			out[3] = clampByte(sums[3])
+			if out[3] == 0 {
+				continue
+			}
+			// the sums are premultiplied by alpha (0..255)
+			for ch := 0; ch < 3; ch++ {
+				if linear {
+					out[ch] = FromLinear(sums[ch] / sums[3])
+				} else {
+					out[ch] = clampByte(sums[ch] * 255 / sums[3])
+				}
+			}
+		}
+	}
+	return result
+}
+
+func boxDownscale(img *image.RGBA, factor int) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx()/factor, b.Dy()/factor
+	result := image.NewNRGBA(image.Rect(0, 0, w, h))
+	count := uint32(factor * factor)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sums [4]uint32
+			for dy := 0; dy < factor; dy++ {
+				pos := (y*factor+dy)*img.Stride + x*factor*4
+				for dx := 0; dx < factor*4; dx++ {
+					sums[dx%4] += uint32(img.Pix[pos+dx])
+				}
+			}
+			out := result.Pix[y*result.Stride+x*4:]
+			out[3] = uint8(sums[3] / count)
+			if sums[3] == 0 {
+				continue
+			}
+			// for opaque pixels, this is the same as sums[ch] / count
+			for ch := 0; ch < 3; ch++ {
+				out[ch] = uint8(sums[ch] * 255 / sums[3])
+			}
+		}
+	}
+	return result
+}
+
+type contribution struct {
+	start   int
+	weights []float64
+}
+
+// contributions computes, for each of the outSize output pixels, which of the
+// inSize input pixels contribute to it and with which weight.
+func contributions(outSize, inSize, factor int, filter Filter) []contribution {
+	radius := float64(factor)
+	if filter == LanczosFilter {
+		radius *= 3
+	}
+	result := make([]contribution, outSize)
+	for o := range result {
+		center := (float64(o) + 0.5) * float64(factor)
+		start := int(math.Floor(center - radius))
+		end := int(math.Ceil(center + radius))
+		if start < 0 {
+			start = 0
+		}
+		if end > inSize {
+			end = inSize
+		}
+		weights := make([]float64, end-start)
+		total := 0.0
+		for i := range weights {
+			d := (float64(start+i) + 0.5 - center) / float64(factor)
+			weights[i] = kernel(filter, d)
+			total += weights[i]
+		}
+		for i := range weights {
+			weights[i] /= total
+		}
+		result[o] = contribution{start, weights}
+	}
+	return result
+}
+
+// premultipliedToLinear converts a channel of a premultiplied color to linear
+// light, premultiplied with alpha (in 0..255).
+func premultipliedToLinear(c, a uint8) float64 {
+	if a == 255 {
+		return ToLinear(c) * 255
+	}
+	straight := uint32(c) * 255 / uint32(a)
+	if straight > 255 {
+		straight = 255
+	}
+	return ToLinear(uint8(straight)) * float64(a)
+}
+
+func kernel(filter Filter, d float64) float64 {
+	d = math.Abs(d)
+	switch filter {
+	case BoxFilter:
+		if d < 0.5 {
+			return 1
+		}
+		return 0
+	case TentFilter:
+		return math.Max(0, 1-d)
+	case LanczosFilter:
+		if d >= 3 {
+			return 0
+		}
+		return sinc(d) * sinc(d/3)
+	}
+	panic("unhandled filter")
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+func clampByte(v float64) uint8 {
+	v = math.Floor(v + 0.5)
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,150 @@
+package unicornify
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var resampleSizes = []struct {
+	w, h, factor int
+}{
+	{1, 1, 2},
+	{5, 3, 2},
+	{3, 7, 3},
+	{7, 5, 4},
+	{9, 1, 3},
+}
+
+var resampleFilters = []Filter{BoxFilter, TentFilter, LanczosFilter}
+
+func uniformRGBA(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func near(a, b uint8) bool {
+	d := int(a) - int(b)
+	return d >= -1 && d <= 1
+}
+
+func TestResampleUniform(t *testing.T) {
+	colors := []struct {
+		in   color.RGBA // premultiplied
+		want color.NRGBA
+	}{
+		{color.RGBA{200, 100, 50, 255}, color.NRGBA{200, 100, 50, 255}},
+		{color.RGBA{100, 50, 0, 128}, color.NRGBA{199, 100, 0, 128}},
+		{color.RGBA{}, color.NRGBA{}},
+	}
+	for _, s := range resampleSizes {
+		for _, f := range resampleFilters {
+			for _, linear := range []bool{false, true} {
+				for _, c := range colors {
+					img := uniformRGBA(s.w*s.factor, s.h*s.factor, c.in)
+					got := Resample(img, s.factor, f, linear)
+					if got.Bounds() != image.Rect(0, 0, s.w, s.h) {
+						t.Errorf("%vx%v %v linear=%v: size %v", s.w, s.h, f, linear, got.Bounds())
+						continue
+					}
+					for y := 0; y < s.h; y++ {
+						for x := 0; x < s.w; x++ {
+							p := got.NRGBAAt(x, y)
+							if !near(p.R, c.want.R) || !near(p.G, c.want.G) || !near(p.B, c.want.B) || !near(p.A, c.want.A) {
+								t.Errorf("%vx%v %v linear=%v: pixel (%v,%v) of %v is %v, want %v", s.w, s.h, f, linear, x, y, c.in, p, c.want)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResampleBoxBlocks(t *testing.T) {
+	// every block of the input has its own color, which the box filter
+	// must reproduce exactly in the corresponding output pixel
+	blockColor := func(x, y int) color.RGBA {
+		return color.RGBA{uint8(40 * x), uint8(30 * y), uint8(10*x + 20*y), 255}
+	}
+	for _, s := range resampleSizes {
+		img := image.NewRGBA(image.Rect(0, 0, s.w*s.factor, s.h*s.factor))
+		for y := 0; y < s.h*s.factor; y++ {
+			for x := 0; x < s.w*s.factor; x++ {
+				img.SetRGBA(x, y, blockColor(x/s.factor, y/s.factor))
+			}
+		}
+		got := Resample(img, s.factor, BoxFilter, false)
+		for y := 0; y < s.h; y++ {
+			for x := 0; x < s.w; x++ {
+				c := blockColor(x, y)
+				want := color.NRGBA{c.R, c.G, c.B, c.A}
+				if p := got.NRGBAAt(x, y); p != want {
+					t.Errorf("%vx%v: pixel (%v,%v) is %v, want %v", s.w, s.h, x, y, p, want)
+				}
+			}
+		}
+	}
+}
+
+func TestResampleEdgeColumn(t *testing.T) {
+	// only the last column is red, the rest is blue; no filter may let the
+	// red spill into the first column or wrap into the next row
+	for _, s := range resampleSizes {
+		if s.w < 3 {
+			continue
+		}
+		img := uniformRGBA(s.w*s.factor, s.h*s.factor, color.RGBA{0, 0, 255, 255})
+		for y := 0; y < s.h*s.factor; y++ {
+			for x := (s.w - 1) * s.factor; x < s.w*s.factor; x++ {
+				img.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+			}
+		}
+		for _, f := range resampleFilters {
+			for _, linear := range []bool{false, true} {
+				got := Resample(img, s.factor, f, linear)
+				for y := 0; y < s.h; y++ {
+					if p := got.NRGBAAt(0, y); p.R > 1 {
+						t.Errorf("%vx%v %v linear=%v: pixel (0,%v) is %v", s.w, s.h, f, linear, y, p)
+					}
+					if p := got.NRGBAAt(s.w-1, y); p.R < p.B {
+						t.Errorf("%vx%v %v linear=%v: pixel (%v,%v) is %v", s.w, s.h, f, linear, s.w-1, y, p)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResampleLinearMix(t *testing.T) {
+	// half black and half white is a mid gray in linear light, which is
+	// much brighter than the sRGB average
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			if (x+y)%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	tests := []struct {
+		linear bool
+		want   uint8
+	}{
+		{false, 128},
+		{true, 188},
+	}
+	for _, tt := range tests {
+		p := Resample(img, 2, BoxFilter, tt.linear).NRGBAAt(0, 0)
+		if !near(p.R, tt.want) || p.R != p.G || p.G != p.B || p.A != 255 {
+			t.Errorf("linear=%v: got %v, want gray %v", tt.linear, p, tt.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ type Ball struct {
 	Center Vector
 	Radius float64
 	Color  Color
+	Part   Part
 }
 
 func NewBall(x, y, z, r float64, c Color) *Ball {
@@ -48,7 +49,9 @@ func (b *Ball) Shift(d Vector) {
 }
 
 func (b *Ball) Shifted(d Vector) *Ball {
-	return NewBallP(b.Center.Plus(d), b.Radius, b.Color)
+	result := NewBallP(b.Center.Plus(d), b.Radius, b.Color)
+	result.Part = b.Part
+	return result
 }
 
 func (b *Ball) MoveToBone(bone Bone) {
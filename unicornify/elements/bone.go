@@ -44,57 +44,71 @@ func (b *Bone) GetTracer(wv WorldView) Tracer {
 	if b.XFunc == nil && b.YFunc == nil {
 		return NewBoneTracer(proj1, proj2)
 	} else {
-		c1 := b1.Color
-		c2 := b2.Color
-
-		v := b2.Center.Minus(b1.Center)
-		length := v.Length()
-		vx, vy := CrossAxes(v.Times(1 / length))
-
-		parts := 255
+		result := NewGroupTracer()
+		for _, seg := range b.Segments(wv, 255) {
+			result.Add(NewBoneTracer(ProjectBall(wv, seg[0]), ProjectBall(wv, seg[1])))
+		}
+		return result
+	}
+}
 
-		calcBall := func(factor float64) BallProjection {
-			col := MixColors(c1, c2, factor)
-			fx, fy := factor, factor
-			if f := b.XFunc; f != nil {
-				fx = f(fx)
-			}
-			if f := b.YFunc; f != nil {
-				fy = f(fy)
+// Segments approximates the bone by straight pieces. It divides the bone into
+// the given number of parts, but merges neighboring parts that bend by less
+// than one degree. For a linear bone, this gives a single piece.
+func (b *Bone) Segments(wv WorldView, parts int) [][2]*Ball {
+	if b.XFunc == nil && b.YFunc == nil {
+		return [][2]*Ball{b.Balls}
+	}
+	var result [][2]*Ball
+	prevBall := b.Balls[0]
+	nextBall := b.BallAt(wv, 1/float64(parts))
+
+	for i := 1; i <= parts; i++ {
+		curBall := nextBall
+
+		if i < parts {
+			nextBall = b.BallAt(wv, float64(i+1)/float64(parts))
+			seg1 := curBall.Center.Minus(prevBall.Center)
+			seg2 := nextBall.Center.Minus(curBall.Center)
+			if seg1.ScalarProd(seg2)/(seg1.Length()*seg2.Length()) > 0.999848 { // cosine of 1°
+				continue
 			}
-
-			c := b1.Center.Plus(v.Times(factor)).Plus(vx.Times((fx - factor) * length)).Plus(vy.Times((fy - factor) * length))
-			r := MixFloats(b1.Radius, b2.Radius, factor)
-			ballp := ProjectBall(wv, NewBallP(c, r, col))
-			return ballp
 		}
 
-		prevBall := proj1
-
-		result := NewGroupTracer()
-
-		nextBall := calcBall(1 / float64(parts))
-
-		for i := 1; i <= parts; i++ {
-			curBall := nextBall
+		result = append(result, [2]*Ball{prevBall, curBall})
+		prevBall = curBall
+	}
+	return result
+}
 
-			if i < parts {
-				nextBall = calcBall(float64(i+1) / float64(parts))
-				seg1 := curBall.BaseBall.Center.Minus(prevBall.BaseBall.Center)
-				seg2 := nextBall.BaseBall.Center.Minus(curBall.BaseBall.Center)
-				if seg1.ScalarProd(seg2)/(seg1.Length()*seg2.Length()) > 0.999848 { // cosine of 1°
-					continue
-				}
-			}
+// BallAt returns the ball at the given position along the bone, where 0 is
+// the first ball and 1 is the second one, taking XFunc and YFunc into account.
+// Its part is the part of the nearer ball.
+func (b *Bone) BallAt(wv WorldView, factor float64) *Ball {
+	b1 := b.Balls[0]
+	b2 := b.Balls[1]
 
-			tracer := NewBoneTracer(prevBall, curBall)
+	v := b2.Center.Minus(b1.Center)
+	length := v.Length()
+	vx, vy := CrossAxes(v.Times(1 / length))
 
-			result.Add(tracer)
+	col := wv.MixColors(b1.Color, b2.Color, factor)
+	fx, fy := factor, factor
+	if f := b.XFunc; f != nil {
+		fx = f(fx)
+	}
+	if f := b.YFunc; f != nil {
+		fy = f(fy)
+	}
 
-			prevBall = curBall
-		}
-		return result
+	c := b1.Center.Plus(v.Times(factor)).Plus(vx.Times((fx - factor) * length)).Plus(vy.Times((fy - factor) * length))
+	r := MixFloats(b1.Radius, b2.Radius, factor)
+	ball := NewBallP(c, r, col)
+	ball.Part = b1.Part
+	if factor >= 0.5 {
+		ball.Part = b2.Part
 	}
+	return ball
 }
 
 type BoneTracer struct {
@@ -108,10 +122,10 @@ func (t *BoneTracer) GetBounds() Bounds {
 	return t.bounds
 }
 
-func (t *BoneTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *BoneTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	return t.traceImpl(x, y, ray, false)
 }
-func (t *BoneTracer) traceImpl(x, y float64, ray Vector, backside bool) (bool, float64, Vector, Color) {
+func (t *BoneTracer) traceImpl(x, y float64, ray Vector, backside bool) (bool, TraceResult) {
 	v1, v2, v3 := ray.Decompose()
 
 	c3 := -2 * (v1*t.w1 + v2*t.w2 + v3*t.w3)
@@ -136,7 +150,7 @@ func (t *BoneTracer) traceImpl(x, y float64, ray Vector, backside bool) (bool, f
 		discz := Sqr(pz)/4 - qz
 
 		if discz < 0 {
-			return false, 0, NoDirection, Color{}
+			return false, TraceResult{}
 		}
 
 		rdiscz := math.Sqrt(discz)
@@ -186,7 +200,7 @@ func (t *BoneTracer) traceImpl(x, y float64, ray Vector, backside bool) (bool, f
 			discz = Sqr(pz)/4 - qz
 
 			if discz < 0 {
-				return false, 0, NoDirection, Color{}
+				return false, TraceResult{}
 			}
 		}
 
@@ -204,21 +218,25 @@ func (t *BoneTracer) traceImpl(x, y float64, ray Vector, backside bool) (bool, f
 
 	p := Vector{v1, v2, v3}.Times(z)
 	dir := p.Minus(Vector{m1, m2, m3})
-	return true, z, dir, MixColors(t.b1.BaseBall.Color, t.b2.BaseBall.Color, f)
+	part := t.b1.BaseBall.Part
+	if f >= 0.5 {
+		part = t.b2.BaseBall.Part
+	}
+	return true, TraceResult{z, dir, t.b1.WorldView.MixColors(t.b1.BaseBall.Color, t.b2.BaseBall.Color, f), part}
 
 }
 
 func (t *BoneTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
-	ok1, z1, dir1, col1 := t.traceImpl(x, y, ray, false)
-	ok2, z2, dir2, col2 := t.traceImpl(x, y, ray, true)
+	ok1, r1 := t.traceImpl(x, y, ray, false)
+	ok2, r2 := t.traceImpl(x, y, ray, true)
 	if ok1 {
 		if !ok2 { // this can happen because of rounding errors
 			return false, TraceIntervals{}
 		}
 		return true, TraceIntervals{
 			TraceInterval{
-				Start: TraceResult{z1, dir1, col1},
-				End:   TraceResult{z2, dir2, col2},
+				Start: r1,
+				End:   r2,
 			},
 		}
 	}
@@ -13,6 +13,11 @@ func (f *Figure) Add(things ...Thing) {
 	f.things = append(f.things, things...)
 }
 
+// Things returns the things that were added to the figure.
+func (f *Figure) Things() []Thing {
+	return f.things
+}
+
 func (f *Figure) GetTracer(wv WorldView) Tracer {
 	gt := NewGroupTracer()
 
@@ -66,22 +66,22 @@ func (t *FlatTracer) TraceToIntersection(x, y float64, ray Vector) (bool, float6
 	return true, inter[0], inter[1], z
 }
 
-func (t *FlatTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *FlatTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	ok, i1, i2, z := t.TraceToIntersection(x, y, ray)
 	if !ok {
-		return false, 0, NoDirection, Color{}
+		return false, TraceResult{}
 	}
 	var col Color
 	if t.fourCorners {
-		col = MixColors(MixColors(t.p1.BaseBall.Color, t.p2.BaseBall.Color, i1), MixColors(t.p3.BaseBall.Color, t.fourthColor, i1), i2)
+		col = t.wv.MixColors(t.wv.MixColors(t.p1.BaseBall.Color, t.p2.BaseBall.Color, i1), t.wv.MixColors(t.p3.BaseBall.Color, t.fourthColor, i1), i2)
 	} else {
 		f1 := 1.0
 		if i2 < 1 {
 			f1 = i1 / (1 - i2)
 		}
-		col = MixColors(MixColors(t.p1.BaseBall.Color, t.p2.BaseBall.Color, f1), t.p3.BaseBall.Color, i2)
+		col = t.wv.MixColors(t.wv.MixColors(t.p1.BaseBall.Color, t.p2.BaseBall.Color, f1), t.p3.BaseBall.Color, i2)
 	}
-	return true, z, t.dir, col
+	return true, TraceResult{Z: z, Direction: t.dir, Color: col, Part: t.p1.BaseBall.Part}
 }
 
 func (t *FlatTracer) GetBounds() Bounds {
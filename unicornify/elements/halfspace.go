@@ -0,0 +1,64 @@
+package elements
+
+import (
+	"math"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+)
+
+// A HalfSpace is everything on one side of a plane through Point, namely the
+// side Normal points to. It has no color of its own; it is meant to cut off
+// other things with an Intersection.
+type HalfSpace struct {
+	Point, Normal Vector
+}
+
+func NewHalfSpace(point, normal Vector) *HalfSpace {
+	return &HalfSpace{point, normal}
+}
+
+type HalfSpaceTracer struct {
+	point, normal Vector // in camera space
+}
+
+func (h *HalfSpace) GetTracer(wv WorldView) Tracer {
+	p := Vector{0, 0, 10000} // see NewFlatTracer
+	pp := wv.ProjectSphere(p, 0).CenterCS
+	return &HalfSpaceTracer{
+		point:  wv.ProjectSphere(h.Point, 0).CenterCS,
+		normal: wv.ProjectSphere(p.Plus(h.Normal), 0).CenterCS.Minus(pp),
+	}
+}
+
+func (t *HalfSpaceTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
+	d := ray.ScalarProd(t.normal)
+	q := t.point.ScalarProd(t.normal)
+	outside := t.normal.Neg()
+	all := TraceInterval{
+		Start: TraceResult{Z: math.Inf(-1), Direction: NoDirection},
+		End:   TraceResult{Z: math.Inf(1), Direction: NoDirection},
+	}
+	switch {
+	case d > 0:
+		all.Start = TraceResult{Z: q / d, Direction: outside}
+	case d < 0:
+		all.End = TraceResult{Z: q / d, Direction: outside}
+	case q > 0:
+		// the ray runs parallel to the plane, outside of the half space
+		return false, EmptyIntervals
+	}
+	return true, TraceIntervals{all}
+}
+
+func (t *HalfSpaceTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
+	return UnDeepifyTrace(t, x, y, ray)
+}
+
+func (t *HalfSpaceTracer) GetBounds() Bounds {
+	inf := math.Inf(1)
+	return Bounds{XMin: -inf, XMax: inf, YMin: -inf, YMax: inf, ZMin: -inf, ZMax: inf}
+}
+
+func (t *HalfSpaceTracer) Pruned(rp RenderingParameters) Tracer {
+	return t
+}
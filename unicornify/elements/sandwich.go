@@ -34,7 +34,7 @@ func (s *Sandwich) GetTracer(wv WorldView) Tracer {
 	}
 }
 
-func (t *SandwichTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *SandwichTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	return UnDeepifyTrace(t, x, y, ray)
 }
 
@@ -42,7 +42,9 @@ func makeSteakTracer(wv WorldView, b1, b2, b3 *Ball, fourCorners bool, fourthCol
 	cross := w12.CrossProd(w13).Unit().Times(b1.Radius)
 	top1 := c1.Plus(cross) // not necessarily on the top in any non-arbitrary way
 	bottom1 := c1.Plus(cross.Neg())
+	part := b1.Part
 	add := func(tri bool, b1, b2, b3 *Ball, fourthColor Color, roughDirection Vector) {
+		b1.Part = part // the flat tracer takes its part from the first corner
 		ft := NewFlatTracer(wv, b1, b2, b3, !tri, fourthColor, roughDirection)
 		result.Add(ft)
 	}
@@ -73,6 +75,7 @@ func makeSteakTracer(wv WorldView, b1, b2, b3 *Ball, fourCorners bool, fourthCol
 		result.Add(NewBone(b1, b2).GetTracer(wv), NewBone(b1, b3).GetTracer(wv))
 		if fourCorners {
 			b4 := NewBallP(b1.Center.Plus(w14), b1.Radius, fourthColor)
+			b4.Part = part
 			result.Add(NewBone(b2, b4).GetTracer(wv), NewBone(b3, b4).GetTracer(wv))
 		} else {
 			result.Add(NewBone(b2, b3).GetTracer(wv))
@@ -0,0 +1,107 @@
+package unicornify
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// DefaultJPEGQuality is the JPEG quality used if a Format doesn't specify one.
+const DefaultJPEGQuality = 90
+
+// A Format describes how an image is encoded by Encode.
+type Format struct {
+	Name    string // "png", "jpeg", "gif", or "svg"
+	Quality int    // the JPEG quality from 1 to 100; zero means DefaultJPEGQuality
+}
+
+var (
+	PNG  = Format{Name: "png"}
+	JPEG = Format{Name: "jpeg"}
+	GIF  = Format{Name: "gif"}
+	SVG  = Format{Name: "svg"} // see RenderSVG; Encode doesn't support it
+)
+
+// ParseFormat returns the format with the given name, which may also be a
+// file extension like "jpg" or ".png".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "png":
+		return PNG, nil
+	case "jpeg", "jpg":
+		return JPEG, nil
+	case "gif":
+		return GIF, nil
+	case "svg":
+		return SVG, nil
+	}
+	return Format{}, fmt.Errorf("unknown format %q; valid formats are png, jpeg, gif, and svg", name)
+}
+
+// Extension returns the usual file extension for the format, without a dot.
+func (f Format) Extension() string {
+	if f.Name == "jpeg" {
+		return "jpg"
+	}
+	return f.Name
+}
+
+// ContentType returns the MIME type for the format.
+func (f Format) ContentType() string {
+	if f.Name == "svg" {
+		return "image/svg+xml"
+	}
+	return "image/" + f.Name
+}
+
+// Encode writes img to w in the given format. JPEG has no transparency, so
+// transparent parts of the image become white. GIF only supports fully
+// transparent pixels and 256 colors; see MakeGIF.
+func Encode(w io.Writer, img *image.NRGBA, format Format) error {
+	switch format.Name {
+	case "png":
+		return png.Encode(w, img)
+	case "jpeg":
+		quality := format.Quality
+		if quality == 0 {
+			quality = DefaultJPEGQuality
+		}
+		if quality < 1 || quality > 100 {
+			return fmt.Errorf("JPEG quality must be between 1 and 100")
+		}
+		return jpeg.Encode(w, onWhite(img), &jpeg.Options{Quality: quality})
+	case "gif":
+		return gif.EncodeAll(w, MakeGIF([]*image.NRGBA{img}, 0))
+	case "svg":
+		return fmt.Errorf("SVG images can't be encoded from a raster image; use RenderSVG")
+	}
+	return fmt.Errorf("unknown format %q", format.Name)
+}
+
+// onWhite returns img composited onto a white background, or img itself if
+// it is opaque.
+func onWhite(img *image.NRGBA) image.Image {
+	if img.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	result := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			a := uint32(c.A)
+			result.SetRGBA(x, y, color.RGBA{
+				uint8((uint32(c.R)*a + 255*(255-a) + 127) / 255),
+				uint8((uint32(c.G)*a + 255*(255-a) + 127) / 255),
+				uint8((uint32(c.B)*a + 255*(255-a) + 127) / 255),
+				255,
+			})
+		}
+	}
+	return result
+}
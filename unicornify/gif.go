@@ -0,0 +1,190 @@
+package unicornify
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"sort"
+)
+
+// MakeGIF combines the frames into a looping animated GIF, showing each frame
+// for delay hundredths of a second. All frames share a single palette that is
+// computed from the colors of all the frames. Pixels that are mostly
+// transparent become fully transparent.
+func MakeGIF(frames []*image.NRGBA, delay int) *gif.GIF {
+	transparent := false
+	for _, f := range frames {
+		if hasTransparency(f) {
+			transparent = true
+			break
+		}
+	}
+	colorCount := 256
+	if transparent {
+		colorCount--
+	}
+	palette := MedianCutPalette(frames, colorCount)
+	if transparent {
+		palette = append(color.Palette{color.RGBA{}}, palette...)
+	}
+
+	result := &gif.GIF{}
+	cache := make(map[color.RGBA]uint8)
+	for _, f := range frames {
+		result.Image = append(result.Image, toPaletted(f, palette, transparent, cache))
+		result.Delay = append(result.Delay, delay)
+		if transparent {
+			// otherwise, the previous frame would shine through
+			result.Disposal = append(result.Disposal, gif.DisposalBackground)
+		} else {
+			result.Disposal = append(result.Disposal, gif.DisposalNone)
+		}
+	}
+	return result
+}
+
+func hasTransparency(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] < 255 {
+			return true
+		}
+	}
+	return false
+}
+
+func toPaletted(img *image.NRGBA, palette color.Palette, transparent bool, cache map[color.RGBA]uint8) *image.Paletted {
+	b := img.Bounds()
+	result := image.NewPaletted(b, palette)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			nc := img.NRGBAAt(x, y)
+			if transparent && nc.A < 128 {
+				result.SetColorIndex(x, y, 0)
+				continue
+			}
+			c := color.RGBA{nc.R, nc.G, nc.B, 255}
+			index, ok := cache[c]
+			if !ok {
+				index = uint8(palette.Index(c))
+				cache[c] = index
+			}
+			result.SetColorIndex(x, y, index)
+		}
+	}
+	return result
+}
+
+type colorCount struct {
+	c     [3]uint8
+	count int
+}
+
+type colorBox struct {
+	colors []colorCount
+	count  int
+}
+
+func (b colorBox) channelRange(ch int) int {
+	lo, hi := 255, 0
+	for _, cc := range b.colors {
+		v := int(cc.c[ch])
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	return hi - lo
+}
+
+func (b colorBox) average() color.RGBA {
+	var sums [3]int
+	for _, cc := range b.colors {
+		for ch := 0; ch < 3; ch++ {
+			sums[ch] += int(cc.c[ch]) * cc.count
+		}
+	}
+	return color.RGBA{
+		uint8((sums[0] + b.count/2) / b.count),
+		uint8((sums[1] + b.count/2) / b.count),
+		uint8((sums[2] + b.count/2) / b.count),
+		255,
+	}
+}
+
+// MedianCutPalette computes a palette of at most maxColors opaque colors
+// that represents the (mostly) opaque pixels of the images well.
+func MedianCutPalette(imgs []*image.NRGBA, maxColors int) color.Palette {
+	histogram := make(map[[3]uint8]int)
+	for _, img := range imgs {
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i+3] < 128 {
+				continue
+			}
+			histogram[[3]uint8{img.Pix[i], img.Pix[i+1], img.Pix[i+2]}]++
+		}
+	}
+	if len(histogram) == 0 {
+		return color.Palette{color.RGBA{0, 0, 0, 255}}
+	}
+
+	all := colorBox{}
+	for c, count := range histogram {
+		all.colors = append(all.colors, colorCount{c, count})
+		all.count += count
+	}
+	// map iteration order is random, but the palette should be deterministic
+	sort.Slice(all.colors, func(i, j int) bool {
+		a, b := all.colors[i].c, all.colors[j].c
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+	boxes := []colorBox{all}
+
+	for len(boxes) < maxColors {
+		// split the box with the largest extent (weighted by pixel count)
+		best, bestCh, bestScore := -1, 0, 0
+		for i, b := range boxes {
+			if len(b.colors) < 2 {
+				continue
+			}
+			for ch := 0; ch < 3; ch++ {
+				if score := b.channelRange(ch) * b.count; score > bestScore {
+					best, bestCh, bestScore = i, ch, score
+				}
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.SliceStable(box.colors, func(i, j int) bool {
+			return box.colors[i].c[bestCh] < box.colors[j].c[bestCh]
+		})
+		half, seen := 0, 0
+		for i, cc := range box.colors {
+			seen += cc.count
+			if seen*2 >= box.count {
+				half = i + 1
+				break
+			}
+		}
+		if half >= len(box.colors) {
+			half = len(box.colors) - 1
+		}
+		lower := colorBox{colors: box.colors[:half]}
+		upper := colorBox{colors: box.colors[half:]}
+		for _, cc := range lower.colors {
+			lower.count += cc.count
+		}
+		upper.count = box.count - lower.count
+		boxes[best] = lower
+		boxes = append(boxes, upper)
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		palette[i] = b.average()
+	}
+	return palette
+}
@@ -61,8 +61,8 @@ func Circle(img *image.RGBA, cx, cy, r int, col Color, coloring ColoringParamete
 
 func circleImpl(img *image.RGBA, cx, cy, r int, col Color, topHalfOnly bool, coloring ColoringParameters) {
 	colrgba := color.RGBA{col.R, col.G, col.B, 255}
-	imgsize := img.Bounds().Dx()
-	if cx < -r || cy < -r || cx-r > imgsize || cy-r > imgsize {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if cx < -r || cy < -r || cx-r > width || cy-r > height {
 		return
 	}
 	f := 1 - r
@@ -79,8 +79,8 @@ func circleImpl(img *image.RGBA, cx, cy, r int, col Color, topHalfOnly bool, col
 		if left < 0 {
 			left = 0
 		}
-		if right >= imgsize {
-			right = imgsize - 1
+		if right >= width {
+			right = width - 1
 		}
 
 		for x := left; x <= right; x++ {
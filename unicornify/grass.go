@@ -7,6 +7,8 @@ import (
 	"math"
 )
 
+// GrassData describes the grass. Horizon and the colors are derived from the
+// BackgroundData, so they can't be changed on their own; Wind isn't used yet.
 type GrassData struct {
 	Horizon        float64
 	Wind           float64
@@ -18,7 +20,12 @@ func (d *GrassData) Randomize(rand *pyrand.Random) {
 	d.Wind = 1.6*rand.Random() - 0.8 // not yet used
 }
 
-func GrassSandwich(groundY float64, bgdata BackgroundData, grassdata GrassData, shift Point2d, scale float64, imageSize int) Thing {
+func GrassSandwich(groundY float64, bgdata BackgroundData, grassdata GrassData, shift Point2d, scale float64, imageWidth int, linear bool) Thing {
+	mix := MixColors
+	if linear {
+		mix = MixColorsLinear
+	}
+
 	var grassSize float64 = 20000
 	var bladeDistance float64 = 4
 	var bladeDiameter float64 = 2
@@ -58,7 +65,7 @@ func GrassSandwich(groundY float64, bgdata BackgroundData, grassdata GrassData,
 
 		prevX := -999999999
 		prevY := -999999999
-		landColor := MixColors(bgdata.Color("Land", bgdata.LandLight), bgdata.Color("Land", bgdata.LandLight/2), (x*scale+shift[0])/float64(imageSize))
+		landColor := mix(bgdata.Color("Land", bgdata.LandLight), bgdata.Color("Land", bgdata.LandLight/2), (x*scale+shift[0])/float64(imageWidth))
 
 		for n := float64(0); n <= crossingCells; n++ {
 
@@ -130,19 +137,19 @@ func GrassSandwich(groundY float64, bgdata BackgroundData, grassdata GrassData,
 
 							if closest.IsEmpty() || closest.Start.Z > z {
 								closest = TraceInterval{
-									TraceResult{z, dir, MixColors(grassdata.Color1, grassdata.Color2, k)},
-									TraceResult{z + k*r0, dir.Neg() /*fixme*/, MixColors(grassdata.Color1, grassdata.Color2, k)},
+									TraceResult{z, dir, mix(grassdata.Color1, grassdata.Color2, k), PartGrass},
+									TraceResult{z + k*r0, dir.Neg() /*fixme*/, mix(grassdata.Color1, grassdata.Color2, k), PartGrass},
 								}
 							}
 							if false {
 								return true, TraceIntervals{
 									TraceInterval{
-										TraceResult{z, dir, MixColors(grassdata.Color1, grassdata.Color2, k)},
-										TraceResult{z + k*r0, dir.Neg() /*fixme*/, MixColors(grassdata.Color1, grassdata.Color2, k)},
+										TraceResult{z, dir, mix(grassdata.Color1, grassdata.Color2, k), PartGrass},
+										TraceResult{z + k*r0, dir.Neg() /*fixme*/, mix(grassdata.Color1, grassdata.Color2, k), PartGrass},
 									},
 									TraceInterval{
-										TraceResult{bZ - 0.1 /*fixme*/, Vector{0, -1, 0}, landColor},
-										TraceResult{bZ /*fixme*/, Vector{0, 1, 0}, landColor},
+										TraceResult{bZ - 0.1 /*fixme*/, Vector{0, -1, 0}, landColor, PartLand},
+										TraceResult{bZ /*fixme*/, Vector{0, 1, 0}, landColor, PartLand},
 									},
 								}
 							}
@@ -154,8 +161,8 @@ func GrassSandwich(groundY float64, bgdata BackgroundData, grassdata GrassData,
 				return true, TraceIntervals{
 					closest,
 					TraceInterval{
-						TraceResult{bZ - 0.1 /*fixme*/, Vector{0, -1, 0}, landColor},
-						TraceResult{bZ /*fixme*/, Vector{0, 1, 0}, landColor},
+						TraceResult{bZ - 0.1 /*fixme*/, Vector{0, -1, 0}, landColor, PartLand},
+						TraceResult{bZ /*fixme*/, Vector{0, 1, 0}, landColor, PartLand},
 					},
 				}
 			}
@@ -164,8 +171,8 @@ func GrassSandwich(groundY float64, bgdata BackgroundData, grassdata GrassData,
 
 		return true, TraceIntervals{
 			TraceInterval{
-				TraceResult{bZ - 0.1 /*fixme*/, Vector{0, -1, 0}, landColor},
-				TraceResult{bZ /*fixme*/, Vector{0, 1, 0}, landColor},
+				TraceResult{bZ - 0.1 /*fixme*/, Vector{0, -1, 0}, landColor, PartLand},
+				TraceResult{bZ /*fixme*/, Vector{0, 1, 0}, landColor, PartLand},
 			},
 		}
 	}
@@ -0,0 +1,134 @@
+package unicornify
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// A HashAlgorithm determines how an email address is turned into the hash a
+// unicorn is generated from.
+type HashAlgorithm int
+
+const (
+	// MD5 gives 32-digit hashes; this is what Gravatar has always used.
+	MD5 HashAlgorithm = iota
+	// SHA256 gives 64-digit hashes, which Gravatar accepts as well.
+	SHA256
+)
+
+func (alg HashAlgorithm) String() string {
+	switch alg {
+	case MD5:
+		return "md5"
+	case SHA256:
+		return "sha256"
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(alg))
+}
+
+// ParseHashAlgorithm returns the algorithm with the given name ("md5" or
+// "sha256").
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	switch strings.ToLower(strings.Replace(name, "-", "", -1)) {
+	case "md5":
+		return MD5, nil
+	case "sha256":
+		return SHA256, nil
+	}
+	return 0, fmt.Errorf("unknown hash algorithm %q; valid algorithms are md5 and sha256", name)
+}
+
+// HashEmail returns the hash of the email address in the same way as
+// Gravatar, i.e. the hexadecimal digest of the trimmed, lowercased address.
+func HashEmail(email string, alg HashAlgorithm) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	switch alg {
+	case SHA256:
+		sum := sha256.Sum256([]byte(email))
+		return hex.EncodeToString(sum[:])
+	default:
+		sum := md5.Sum([]byte(email))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// NormalizeID brings an identifier into the canonical form that HashID
+// hashes:
+//
+//   - leading and trailing white space is removed;
+//   - a UUID (32 hex digits, optionally with the usual hyphens and enclosed
+//     in braces or prefixed with "urn:uuid:", in any case) becomes its
+//     lowercase, hyphenated form, e.g. "123e4567-e89b-12d3-a456-426614174000";
+//     this includes 32 decimal digits without hyphens, which are taken as a
+//     UUID and not as a number;
+//   - otherwise, a decimal integer loses its "+" sign and leading zeros, e.g.
+//     "007" becomes "7" and "-0" becomes "0";
+//   - anything else is kept as it is, in particular it stays case-sensitive.
+func NormalizeID(id string) string {
+	id = strings.TrimSpace(id)
+	if uuid, ok := normalizeUUID(id); ok {
+		return uuid
+	}
+	if isDecimal(id) {
+		n, _ := new(big.Int).SetString(strings.TrimPrefix(id, "+"), 10)
+		return n.String()
+	}
+	return id
+}
+
+// HashID returns the hash for an arbitrary identifier, such as a username, a
+// UUID, or a numeric database ID: the hexadecimal SHA-256 digest of the UTF-8
+// bytes of NormalizeID(id). Other systems can compute the same hash to get
+// the same unicorn.
+func HashID(id string) string {
+	sum := sha256.Sum256([]byte(NormalizeID(id)))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeUUID(s string) (string, bool) {
+	lower := strings.ToLower(s)
+	lower = strings.TrimPrefix(lower, "urn:uuid:")
+	if strings.HasPrefix(lower, "{") && strings.HasSuffix(lower, "}") {
+		lower = lower[1 : len(lower)-1]
+	}
+	var digits string
+	switch len(lower) {
+	case 32:
+		digits = lower
+	case 36:
+		for _, i := range []int{8, 13, 18, 23} {
+			if lower[i] != '-' {
+				return "", false
+			}
+		}
+		digits = strings.Replace(lower, "-", "", -1)
+	default:
+		return "", false
+	}
+	if len(digits) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", false
+	}
+	return digits[:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:], true
+}
+
+func isDecimal(s string) bool {
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
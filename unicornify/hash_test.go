@@ -0,0 +1,68 @@
+package unicornify
+
+import "testing"
+
+func TestNormalizeID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"  Alice\t\n", "Alice"},
+		{"", ""},
+		{"007", "7"},
+		{"+7", "7"},
+		{"-007", "-7"},
+		{"-0", "0"},
+		{"+", "+"},
+		{"12345678901234567890123456789", "12345678901234567890123456789"},
+		{"123E4567-E89B-12D3-A456-426614174000", "123e4567-e89b-12d3-a456-426614174000"},
+		{"123e4567e89b12d3a456426614174000", "123e4567-e89b-12d3-a456-426614174000"},
+		{"{123e4567-e89b-12d3-a456-426614174000}", "123e4567-e89b-12d3-a456-426614174000"},
+		{"urn:uuid:123e4567-e89b-12d3-a456-426614174000", "123e4567-e89b-12d3-a456-426614174000"},
+		{"URN:UUID:{123E4567E89B12D3A456426614174000}", "123e4567-e89b-12d3-a456-426614174000"},
+		// 32 decimal digits are a UUID, not a number
+		{"00000000000000000000000000000001", "00000000-0000-0000-0000-000000000001"},
+		{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000001"},
+		// but not with other lengths
+		{"0000000000000000000000000000001", "1"},
+		{"123e4567-e89b12d3-a456-4266141740000", "123e4567-e89b12d3-a456-4266141740000"},
+		{"123g4567-e89b-12d3-a456-426614174000", "123g4567-e89b-12d3-a456-426614174000"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeID(tt.in); got != tt.want {
+			t.Errorf("NormalizeID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHashID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		// sha256 of "alice", "7", and the empty string
+		{"alice", "2bd806c97f0e00af1a1fc3328fa763a9269723c8db8fac4f93af71db186d6e90"},
+		{" 007 ", "7902699be42c8a8e46fbbb4501726517e86b22c56a189f7625a6da49081b2451"},
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+	for _, tt := range tests {
+		if got := HashID(tt.in); got != tt.want {
+			t.Errorf("HashID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// identifiers with the same normalized form have the same hash
+	same := [][]string{
+		{"7", "+7", "007"},
+		{"123e4567-e89b-12d3-a456-426614174000", "{123E4567E89B12D3A456426614174000}"},
+	}
+	for _, ids := range same {
+		for _, id := range ids[1:] {
+			if HashID(id) != HashID(ids[0]) {
+				t.Errorf("HashID(%q) != HashID(%q)", id, ids[0])
+			}
+		}
+	}
+	if HashID("Alice") == HashID("alice") {
+		t.Error("HashID is not case-sensitive")
+	}
+}
@@ -0,0 +1,163 @@
+package unicornify
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
+)
+
+// The parts of the scene that are distinguished in a segmentation mask. The
+// value of each part is its index in the mask's palette; index 0 (NoPart) is
+// the transparent background of a free avatar.
+const (
+	PartSky Part = iota + 1
+	PartLand
+	PartRainbow
+	PartCloud
+	PartGrass
+	PartBody
+	PartHorn
+	PartEye
+	PartPupil
+	PartBrow
+	PartEar
+	PartMane
+	PartTail
+	PartLeg
+	PartWing
+
+	partCount = iota + 1
+)
+
+var partNames = [partCount]string{
+	"none", "sky", "land", "rainbow", "cloud", "grass",
+	"body", "horn", "eye", "pupil", "brow", "ear", "mane", "tail", "leg", "wing",
+}
+
+// MaskPalette is the palette of segmentation masks. The colors are arbitrary,
+// but distinct enough to make the mask easy to look at.
+var MaskPalette = color.Palette{
+	color.RGBA{0, 0, 0, 0},
+	color.RGBA{135, 206, 235, 255},
+	color.RGBA{139, 90, 43, 255},
+	color.RGBA{255, 0, 255, 255},
+	color.RGBA{255, 255, 255, 255},
+	color.RGBA{34, 139, 34, 255},
+	color.RGBA{245, 222, 179, 255},
+	color.RGBA{255, 215, 0, 255},
+	color.RGBA{0, 255, 255, 255},
+	color.RGBA{0, 0, 0, 255},
+	color.RGBA{139, 0, 0, 255},
+	color.RGBA{255, 160, 122, 255},
+	color.RGBA{148, 0, 211, 255},
+	color.RGBA{255, 20, 147, 255},
+	color.RGBA{30, 144, 255, 255},
+	color.RGBA{255, 250, 205, 255},
+}
+
+// PartName returns the name of the part, as used in the mask legend.
+func PartName(p Part) string {
+	if int(p) < partCount {
+		return partNames[p]
+	}
+	return fmt.Sprintf("Part(%d)", int(p))
+}
+
+// A MaskLegendEntry describes one index of a segmentation mask.
+type MaskLegendEntry struct {
+	Index int
+	Name  string
+	Color string // as #rrggbb
+}
+
+// MaskLegend returns the meaning of every index that can occur in a
+// segmentation mask.
+func MaskLegend() []MaskLegendEntry {
+	result := make([]MaskLegendEntry, partCount)
+	for i := range result {
+		c := MaskPalette[i].(color.RGBA)
+		result[i] = MaskLegendEntry{
+			Index: i,
+			Name:  partNames[i],
+			Color: hexColor(Color{R: c.R, G: c.G, B: c.B}),
+		}
+	}
+	return result
+}
+
+// assignParts sets the part of every ball of the unicorn.
+func (u *Unicorn) assignParts() {
+	setPart := func(part Part, balls ...*Ball) {
+		for _, b := range balls {
+			b.Part = part
+		}
+	}
+	setPart(PartBody, u.Head, u.Snout, u.Shoulder, u.Butt)
+	setPart(PartHorn, u.HornOnset, u.HornTip)
+	setPart(PartEye, u.EyeLeft, u.EyeRight)
+	setPart(PartPupil, u.PupilLeft, u.PupilRight)
+	setPart(PartBrow, u.BrowLeftInner, u.BrowLeftMiddle, u.BrowLeftOuter,
+		u.BrowRightInner, u.BrowRightMiddle, u.BrowRightOuter)
+	setPart(PartTail, u.TailStart, u.TailEnd)
+	if u.TailMid != nil {
+		setPart(PartTail, u.TailMid)
+	}
+	for _, l := range u.Legs {
+		setPart(PartLeg, l.Hip, l.Knee, l.Hoof)
+	}
+	for _, f := range []*Figure{u.EarLeft, u.EarRight} {
+		for b := range f.BallSet() {
+			b.Part = PartEar
+		}
+	}
+	for b := range u.Hairs.BallSet() {
+		b.Part = PartMane
+	}
+	for _, f := range []*Figure{u.WingLeft, u.WingRight} {
+		if f == nil {
+			continue
+		}
+		for b := range f.BallSet() {
+			b.Part = PartWing
+		}
+	}
+}
+
+// segmentationMask combines the parts recorded in gb with the background parts
+// (which may be nil if there is no background) into an indexed image that is
+// smaller by the given factor. Each pixel gets the part that is most common in
+// its block.
+func segmentationMask(gb *GBuffer, background []Part, factor int) *image.Paletted {
+	w, h := gb.Rect.Dx()/factor, gb.Rect.Dy()/factor
+	result := image.NewPaletted(image.Rect(0, 0, w, h), MaskPalette)
+
+	var counts [partCount]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			counts = [partCount]int{}
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					i := (y*factor+dy)*gb.Rect.Dx() + x*factor + dx
+					part := gb.Part[i]
+					if part == NoPart && background != nil {
+						part = background[i]
+					}
+					if int(part) < partCount {
+						counts[part]++
+					}
+				}
+			}
+			best := NoPart
+			for p, c := range counts {
+				if c > counts[best] {
+					best = Part(p)
+				}
+			}
+			result.Pix[y*result.Stride+x] = uint8(best)
+		}
+	}
+	return result
+}
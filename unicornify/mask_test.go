@@ -0,0 +1,89 @@
+package unicornify
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
+)
+
+func TestSegmentationMaskParts(t *testing.T) {
+	var mask *image.Paletted
+	opts := DefaultOptions()
+	opts.Size = 128
+	opts.ZoomOut = true
+	opts.SegmentationMask = func(m *image.Paletted) {
+		mask = m
+	}
+	if _, _, err := Render(context.Background(), "7daf6c79d4802916d83f6266e24850af", opts); err != nil {
+		t.Fatal(err)
+	}
+	if mask == nil {
+		t.Fatal("no mask")
+	}
+	if mask.Bounds() != image.Rect(0, 0, 128, 128) {
+		t.Errorf("mask has size %v", mask.Bounds())
+	}
+
+	count := map[Part]int{}
+	for _, p := range mask.Pix {
+		count[Part(p)]++
+	}
+	// the horn and the tail are bones between balls of their own part, so
+	// they mustn't take the part of the head or the butt they're attached to
+	for _, p := range []Part{PartSky, PartLand, PartGrass, PartBody, PartHorn, PartMane, PartTail, PartLeg} {
+		if count[p] == 0 {
+			t.Errorf("no pixels of part %v", PartName(p))
+		}
+	}
+	if count[NoPart] != 0 {
+		t.Errorf("%v pixels have no part", count[NoPart])
+	}
+}
+
+func TestSegmentationMaskWings(t *testing.T) {
+	var mask *image.Paletted
+	opts := DefaultOptions()
+	opts.Size = 128
+	opts.ZoomOut = true
+	opts.Overrides = []Override{{"HasWings", 1}}
+	opts.SegmentationMask = func(m *image.Paletted) {
+		mask = m
+	}
+	if _, _, err := Render(context.Background(), "7daf6c79d4802916d83f6266e24850af", opts); err != nil {
+		t.Fatal(err)
+	}
+	wing := 0
+	for _, p := range mask.Pix {
+		if Part(p) == PartWing {
+			wing++
+		}
+	}
+	if wing == 0 {
+		t.Error("no pixels of the wings")
+	}
+}
+
+func TestBonePartFollowsNearerBall(t *testing.T) {
+	horn := NewBall(0, 0, 0, 5, Color{})
+	horn.Part = PartHorn
+	head := NewBall(100, 0, 0, 20, Color{})
+	head.Part = PartBody
+	bone := NewBone(horn, head)
+	tests := []struct {
+		at   float64
+		want Part
+	}{
+		{0, PartHorn},
+		{0.25, PartHorn},
+		{0.75, PartBody},
+		{1, PartBody},
+	}
+	for _, tt := range tests {
+		if got := bone.BallAt(WorldView{}, tt.at).Part; got != tt.want {
+			t.Errorf("part at %v is %v, want %v", tt.at, PartName(got), PartName(tt.want))
+		}
+	}
+}
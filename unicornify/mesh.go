@@ -0,0 +1,469 @@
+package unicornify
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
+)
+
+// DefaultMeshResolution is the mesh resolution used if MeshOptions doesn't
+// specify one.
+const DefaultMeshResolution = 128
+
+// MeshOptions control how RenderMesh creates a mesh.
+type MeshOptions struct {
+	// Resolution is the number of grid cells along the longest side of
+	// the unicorn. Higher values give finer meshes; thin parts like the
+	// tips of the mane may be lost if it is too low. Zero means
+	// DefaultMeshResolution.
+	Resolution int
+
+	// Overrides are applied to the data before meshing, as for Render.
+	Overrides []Override
+}
+
+// A Mesh is a closed triangle mesh of the unicorn with a color for every
+// vertex. The coordinates are in the unicorn's own units (the unicorn is
+// roughly 400 units long) with the y axis pointing up, and the lowest
+// point at y = 0. Triangles are ordered counter-clockwise when seen from
+// the outside.
+type Mesh struct {
+	Vertices  []Vector
+	Colors    []Color
+	Triangles [][3]int
+}
+
+// RenderMesh creates a triangle mesh of the unicorn for the given hash, e.g.
+// for 3D printing. The surface is extracted from the same balls, bones, and
+// CSG operations that are used for rendering; since every grid edge that
+// crosses the surface gets exactly one vertex, the mesh is watertight.
+func RenderMesh(ctx context.Context, hash string, opts MeshOptions) (*Mesh, AllData, error) {
+	allData, err := randomize(hash, false)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	if err := allData.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	mesh, err := makeMesh(ctx, allData, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return mesh, allData, nil
+}
+
+// RenderMeshFromData is like RenderMesh, but for the unicorn described by data.
+func RenderMeshFromData(ctx context.Context, data AllData, opts MeshOptions) (*Mesh, error) {
+	if err := data.Apply(opts.Overrides); err != nil {
+		return nil, err
+	}
+	if err := data.validate(); err != nil {
+		return nil, err
+	}
+	return makeMesh(ctx, data, opts)
+}
+
+// A shape is a solid described by a distance function that is negative
+// inside and positive outside. It only needs to be accurate near the
+// surface and within the shape's bounding box.
+type shape interface {
+	eval(p Vector) (float64, Color)
+	bounds() (min, max Vector)
+}
+
+// shapesOf returns the shapes whose union makes up t.
+func shapesOf(t Thing) []shape {
+	var wv WorldView // only needed for mixing colors
+	switch t := t.(type) {
+	case *Ball:
+		return []shape{ballShape{t.Center, t.Radius, t.Color}}
+	case *Bone:
+		var result []shape
+		for _, seg := range t.Segments(wv, 255) {
+			result = append(result, newConeShape(seg[0], seg[1]))
+		}
+		return result
+	case *Figure:
+		var result []shape
+		for _, th := range t.Things() {
+			result = append(result, shapesOf(th)...)
+		}
+		return result
+	case *Steak:
+		result := []shape{newSlabShape(t)}
+		if t.Rounded {
+			b1, b2, b3 := t.Balls[0], t.Balls[1], t.Balls[2]
+			result = append(result, newConeShape(b1, b2), newConeShape(b1, b3))
+			if t.FourCorners {
+				b4 := NewBallP(b2.Center.Plus(b3.Center.Minus(b1.Center)), b1.Radius, t.FourthColor)
+				result = append(result, newConeShape(b2, b4), newConeShape(b3, b4))
+			} else {
+				result = append(result, newConeShape(b2, b3))
+			}
+		}
+		return result
+	case *Intersection:
+		return []shape{csgShape{unionShape(shapesOf(t.Base)), unionShape(shapesOf(t.Other)), false}}
+	case *Difference:
+		return []shape{csgShape{unionShape(shapesOf(t.Base)), unionShape(shapesOf(t.Subtrahend)), true}}
+	}
+	panic("unhandled thing type")
+}
+
+type ballShape struct {
+	center Vector
+	radius float64
+	color  Color
+}
+
+func (s ballShape) eval(p Vector) (float64, Color) {
+	return p.Minus(s.center).Length() - s.radius, s.color
+}
+
+func (s ballShape) bounds() (Vector, Vector) {
+	r := Vector{s.radius, s.radius, s.radius}
+	return s.center.Minus(r), s.center.Plus(r)
+}
+
+// coneShape is a straight bone, i.e. the union of all the balls between its
+// two end balls.
+type coneShape struct {
+	b1, b2 Ball
+	axis   Vector  // unit vector from b1 to b2
+	length float64 // distance between the centers
+	slope  float64 // change of the radius per unit of length
+}
+
+func newConeShape(b1, b2 *Ball) shape {
+	v := b2.Center.Minus(b1.Center)
+	length := v.Length()
+	if length <= math.Abs(b2.Radius-b1.Radius) {
+		// one ball contains the other
+		if b2.Radius > b1.Radius {
+			b1 = b2
+		}
+		return ballShape{b1.Center, b1.Radius, b1.Color}
+	}
+	return coneShape{*b1, *b2, v.Times(1 / length), length, (b2.Radius - b1.Radius) / length}
+}
+
+func (s coneShape) eval(p Vector) (float64, Color) {
+	// find the ball along the axis whose surface is nearest to p
+	a := p.Minus(s.b1.Center)
+	t := a.ScalarProd(s.axis)
+	h := a.Minus(s.axis.Times(t)).Length()
+	pos := math.Max(0, math.Min(s.length, t+s.slope*h/math.Sqrt(1-Sqr(s.slope))))
+	d := a.Minus(s.axis.Times(pos)).Length() - (s.b1.Radius + s.slope*pos)
+	return d, MixColors(s.b1.Color, s.b2.Color, pos/s.length)
+}
+
+func (s coneShape) bounds() (Vector, Vector) {
+	min1, max1 := ballShape{s.b1.Center, s.b1.Radius, Color{}}.bounds()
+	min2, max2 := ballShape{s.b2.Center, s.b2.Radius, Color{}}.bounds()
+	return minVector(min1, min2), maxVector(max1, max2)
+}
+
+// slabShape is the flat part of a steak: a triangle or parallelogram with the
+// thickness of twice the first ball's radius.
+type slabShape struct {
+	origin, w12, w13 Vector
+	normal           Vector
+	halfThickness    float64
+	edges            [][2]Vector // a point on each edge and its outward normal
+	colors           [4]Color
+	fourCorners      bool
+	min, max         Vector
+}
+
+func newSlabShape(st *Steak) shape {
+	b1, b2, b3 := st.Balls[0], st.Balls[1], st.Balls[2]
+	s := slabShape{
+		origin:        b1.Center,
+		w12:           b2.Center.Minus(b1.Center),
+		w13:           b3.Center.Minus(b1.Center),
+		halfThickness: b1.Radius,
+		colors:        [4]Color{b1.Color, b2.Color, b3.Color, st.FourthColor},
+		fourCorners:   st.FourCorners,
+	}
+	s.normal = s.w12.CrossProd(s.w13).Unit()
+	corners := []Vector{b1.Center, b2.Center, b3.Center}
+	if st.FourCorners {
+		corners = []Vector{b1.Center, b2.Center, b2.Center.Plus(s.w13), b3.Center}
+	}
+	var centroid Vector
+	for _, c := range corners {
+		centroid = centroid.Plus(c.Times(1 / float64(len(corners))))
+	}
+	s.min, s.max = corners[0], corners[0]
+	for i, a := range corners {
+		b := corners[(i+1)%len(corners)]
+		out := b.Minus(a).CrossProd(s.normal).Unit()
+		if out.ScalarProd(centroid.Minus(a)) > 0 {
+			out = out.Neg()
+		}
+		s.edges = append(s.edges, [2]Vector{a, out})
+		s.min, s.max = minVector(s.min, a), maxVector(s.max, a)
+	}
+	r := Vector{s.halfThickness, s.halfThickness, s.halfThickness}
+	s.min, s.max = s.min.Minus(r), s.max.Plus(r)
+	return s
+}
+
+func (s slabShape) eval(p Vector) (float64, Color) {
+	rel := p.Minus(s.origin)
+	d := math.Abs(rel.ScalarProd(s.normal)) - s.halfThickness
+	for _, e := range s.edges {
+		d = math.Max(d, p.Minus(e[0]).ScalarProd(e[1]))
+	}
+
+	// the color is mixed like in the flat tracer
+	ok, inter := IntersectionOfPlaneAndLine(s.origin, s.w12, s.w13, p, s.normal)
+	if !ok {
+		return d, s.colors[0]
+	}
+	i1 := math.Max(0, math.Min(1, inter[0]))
+	i2 := math.Max(0, math.Min(1, inter[1]))
+	if s.fourCorners {
+		return d, MixColors(MixColors(s.colors[0], s.colors[1], i1), MixColors(s.colors[2], s.colors[3], i1), i2)
+	}
+	f1 := 1.0
+	if i2 < 1 {
+		f1 = math.Min(1, i1/(1-i2))
+	}
+	return d, MixColors(MixColors(s.colors[0], s.colors[1], f1), s.colors[2], i2)
+}
+
+func (s slabShape) bounds() (Vector, Vector) {
+	return s.min, s.max
+}
+
+// unionShape is the union of several shapes; its color is that of the shape
+// whose surface is nearest.
+type unionShape []shape
+
+func (s unionShape) eval(p Vector) (float64, Color) {
+	d, col := math.Inf(1), Color{}
+	for _, sh := range s {
+		if sd, scol := sh.eval(p); sd < d {
+			d, col = sd, scol
+		}
+	}
+	return d, col
+}
+
+func (s unionShape) bounds() (Vector, Vector) {
+	min, max := s[0].bounds()
+	for _, sh := range s[1:] {
+		smin, smax := sh.bounds()
+		min, max = minVector(min, smin), maxVector(max, smax)
+	}
+	return min, max
+}
+
+// csgShape is the intersection of base and other, or, if subtract is true,
+// the difference. The color is always that of base.
+type csgShape struct {
+	base, other shape
+	subtract    bool
+}
+
+func (s csgShape) eval(p Vector) (float64, Color) {
+	d, col := s.base.eval(p)
+	od, _ := s.other.eval(p)
+	if s.subtract {
+		od = -od
+	}
+	return math.Max(d, od), col
+}
+
+func (s csgShape) bounds() (Vector, Vector) {
+	return s.base.bounds()
+}
+
+func minVector(a, b Vector) Vector {
+	return Vector{math.Min(a[0], b[0]), math.Min(a[1], b[1]), math.Min(a[2], b[2])}
+}
+
+func maxVector(a, b Vector) Vector {
+	return Vector{math.Max(a[0], b[0]), math.Max(a[1], b[1]), math.Max(a[2], b[2])}
+}
+
+// The six tetrahedra a grid cell is split into, as indices of the cell's
+// corners (bit 0 is x, bit 1 is y, bit 2 is z). All of them share the
+// diagonal from corner 0 to corner 7, so that neighboring cells split their
+// common face the same way.
+var cellTetrahedra = [6][4]int{
+	{0, 7, 1, 3}, {0, 7, 3, 2}, {0, 7, 2, 6},
+	{0, 7, 6, 4}, {0, 7, 4, 5}, {0, 7, 5, 1},
+}
+
+// makeMesh extracts the surface of the unicorn with marching tetrahedra.
+func makeMesh(ctx context.Context, allData AllData, opts MeshOptions) (*Mesh, error) {
+	resolution := opts.Resolution
+	if resolution == 0 {
+		resolution = DefaultMeshResolution
+	}
+	if resolution < 2 {
+		return nil, errors.New("mesh resolution must be at least 2")
+	}
+	allData.prepare()
+	uni := poseUnicorn(allData.UnicornData)
+	shapes := unionShape(shapesOf(&uni.Figure))
+
+	// the grid has an empty margin of one cell around the unicorn, so the
+	// surface is closed
+	min, max := shapes.bounds()
+	size := max.Minus(min)
+	cell := math.Max(size[0], math.Max(size[1], size[2])) / float64(resolution)
+	min = min.Minus(Vector{cell, cell, cell})
+	var dims [3]int
+	for i := range dims {
+		dims[i] = int(math.Ceil(size[i]/cell)) + 3
+	}
+	index := func(x, y, z int) int {
+		return (z*dims[1]+y)*dims[0] + x
+	}
+	point := func(x, y, z int) Vector {
+		return min.Plus(Vector{float64(x) * cell, float64(y) * cell, float64(z) * cell})
+	}
+
+	// Each shape only updates the grid points within (a margin around) its
+	// bounds; all other points stay outside.
+	field := make([]float64, dims[0]*dims[1]*dims[2])
+	for i := range field {
+		field[i] = math.Inf(1)
+	}
+	shapeBounds := make([][2]Vector, len(shapes))
+	for si, sh := range shapes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		smin, smax := sh.bounds()
+		margin := Vector{2 * cell, 2 * cell, 2 * cell}
+		shapeBounds[si] = [2]Vector{smin.Minus(margin), smax.Plus(margin)}
+		var lo, hi [3]int
+		for i := range lo {
+			lo[i] = Max(0, int(math.Floor((smin[i]-min[i])/cell))-2)
+			hi[i] = Min(dims[i]-1, int(math.Ceil((smax[i]-min[i])/cell))+2)
+		}
+		for z := lo[2]; z <= hi[2]; z++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				for x := lo[0]; x <= hi[0]; x++ {
+					i := index(x, y, z)
+					if d, _ := sh.eval(point(x, y, z)); d < field[i] {
+						field[i] = d
+					}
+				}
+			}
+		}
+	}
+
+	mesh := &Mesh{}
+	edgeVertices := make(map[[2]int]int)
+	vertex := func(i1, i2 int, p1, p2 Vector) int {
+		key := [2]int{i1, i2}
+		if i1 > i2 {
+			key = [2]int{i2, i1}
+		}
+		if v, ok := edgeVertices[key]; ok {
+			return v
+		}
+		t := field[i1] / (field[i1] - field[i2])
+		p := p1.Plus(p2.Minus(p1).Times(t))
+		col := nearestColor(shapes, shapeBounds, p)
+		mesh.Vertices = append(mesh.Vertices, p)
+		mesh.Colors = append(mesh.Colors, col)
+		edgeVertices[key] = len(mesh.Vertices) - 1
+		return len(mesh.Vertices) - 1
+	}
+
+	var corners [8]int
+	var cornerPoints [8]Vector
+	for z := 0; z < dims[2]-1; z++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for y := 0; y < dims[1]-1; y++ {
+			for x := 0; x < dims[0]-1; x++ {
+				inside := 0
+				for c := range corners {
+					cx, cy, cz := x+c&1, y+(c>>1)&1, z+(c>>2)&1
+					corners[c] = index(cx, cy, cz)
+					cornerPoints[c] = point(cx, cy, cz)
+					if field[corners[c]] < 0 {
+						inside++
+					}
+				}
+				if inside == 0 || inside == 8 {
+					continue
+				}
+				for _, tet := range cellTetrahedra {
+					var in, out []int
+					for _, c := range tet {
+						if field[corners[c]] < 0 {
+							in = append(in, c)
+						} else {
+							out = append(out, c)
+						}
+					}
+					v := func(a, b int) int {
+						return vertex(corners[a], corners[b], cornerPoints[a], cornerPoints[b])
+					}
+					switch len(in) {
+					case 1:
+						mesh.addTriangle(v(in[0], out[0]), v(in[0], out[1]), v(in[0], out[2]), cornerPoints[in[0]])
+					case 3:
+						mesh.addTriangle(v(in[0], out[0]), v(in[1], out[0]), v(in[2], out[0]), cornerPoints[in[0]])
+					case 2:
+						a, b := v(in[0], out[0]), v(in[0], out[1])
+						c, d := v(in[1], out[1]), v(in[1], out[0])
+						mesh.addTriangle(a, b, c, cornerPoints[in[0]])
+						mesh.addTriangle(a, c, d, cornerPoints[in[0]])
+					}
+				}
+			}
+		}
+	}
+
+	// y points up, and the rotation around the x axis keeps the orientation
+	// of the triangles
+	lowest := math.Inf(1)
+	for i, p := range mesh.Vertices {
+		mesh.Vertices[i] = Vector{p[0], -p[1], -p[2]}
+		lowest = math.Min(lowest, -p[1])
+	}
+	for i := range mesh.Vertices {
+		mesh.Vertices[i][1] -= lowest
+	}
+	return mesh, nil
+}
+
+// nearestColor returns the color of the shape whose surface is nearest to p,
+// only considering the shapes whose (extended) bounds contain p.
+func nearestColor(shapes []shape, bounds [][2]Vector, p Vector) Color {
+	d, col := math.Inf(1), Color{}
+	for i, sh := range shapes {
+		b := bounds[i]
+		if p[0] < b[0][0] || p[1] < b[0][1] || p[2] < b[0][2] || p[0] > b[1][0] || p[1] > b[1][1] || p[2] > b[1][2] {
+			continue
+		}
+		if sd, scol := sh.eval(p); sd < d {
+			d, col = sd, scol
+		}
+	}
+	return col
+}
+
+// addTriangle adds the triangle, flipping it if necessary so that it faces
+// away from the point inside, which is on the inner side of the surface.
+func (m *Mesh) addTriangle(a, b, c int, inside Vector) {
+	pa, pb, pc := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+	normal := pb.Minus(pa).CrossProd(pc.Minus(pa))
+	if normal.ScalarProd(pa.Minus(inside)) < 0 {
+		b, c = c, b
+	}
+	m.Triangles = append(m.Triangles, [3]int{a, b, c})
+}
@@ -0,0 +1,125 @@
+package unicornify
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMeshIsClosedManifold(t *testing.T) {
+	for _, hash := range []string{
+		"0123456789abcdef0123456789abcdef",
+		"7daf6c79d4802916d83f6266e24850af",
+		"b50eb7b293596008ecbb108815f82d31",
+	} {
+		mesh, _, err := RenderMesh(context.Background(), hash, MeshOptions{Resolution: 32})
+		if err != nil {
+			t.Fatalf("%v: %v", hash, err)
+		}
+		checkClosedManifold(t, hash, mesh)
+	}
+}
+
+func TestMeshPoses(t *testing.T) {
+	for i, name := range PoseNames {
+		mesh, _, err := RenderMesh(context.Background(), "b50eb7b293596008ecbb108815f82d31", MeshOptions{Resolution: 32, Overrides: []Override{{"PoseKindIndex", float64(i)}}})
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		checkClosedManifold(t, name, mesh)
+	}
+}
+
+// checkClosedManifold reports an error if mesh is empty or isn't a closed,
+// consistently oriented surface.
+func checkClosedManifold(t *testing.T, name string, mesh *Mesh) {
+	t.Helper()
+	if len(mesh.Triangles) == 0 {
+		t.Errorf("%v: the mesh is empty", name)
+		return
+	}
+	if len(mesh.Colors) != len(mesh.Vertices) {
+		t.Errorf("%v: %v colors for %v vertices", name, len(mesh.Colors), len(mesh.Vertices))
+	}
+
+	// In a closed, consistently oriented mesh, every edge is used by
+	// exactly two triangles, once in each direction.
+	type edge [2]int
+	directed := map[edge]int{}
+	for _, tri := range mesh.Triangles {
+		if tri[0] == tri[1] || tri[1] == tri[2] || tri[2] == tri[0] {
+			t.Errorf("%v: degenerate triangle %v", name, tri)
+		}
+		for i := range tri {
+			a, b := tri[i], tri[(i+1)%3]
+			if a < 0 || a >= len(mesh.Vertices) {
+				t.Fatalf("%v: vertex index %v out of range", name, a)
+			}
+			directed[edge{a, b}]++
+		}
+	}
+	bad := 0
+	for e, n := range directed {
+		if n != 1 || directed[edge{e[1], e[0]}] != 1 {
+			bad++
+		}
+	}
+	if bad > 0 {
+		t.Errorf("%v: %v of %v edges are not shared by exactly two triangles with opposite orientation", name, bad, len(directed))
+	}
+}
+
+func TestMeshResolution(t *testing.T) {
+	if _, _, err := RenderMesh(context.Background(), "ffff", MeshOptions{Resolution: 1}); err == nil {
+		t.Error("resolution 1 was accepted")
+	}
+}
+
+func TestMeshFromDataAppliesOverrides(t *testing.T) {
+	data, err := randomize("7daf6c79d4802916d83f6266e24850af", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.UnicornData.HornLength = 0
+	plain, err := RenderMeshFromData(context.Background(), data, MeshOptions{Resolution: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	horned, err := RenderMeshFromData(context.Background(), data, MeshOptions{Resolution: 32, Overrides: []Override{{"HornLength", 250}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the resolution is relative to the size, so the horn shows in the
+	// extent of the mesh rather than in the number of triangles
+	if a, b := meshSize(horned), meshSize(plain); a <= b {
+		t.Errorf("the mesh with a long horn has size %v, the one without %v", a, b)
+	}
+}
+
+func TestMeshWithWings(t *testing.T) {
+	data, err := randomize("7daf6c79d4802916d83f6266e24850af", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := RenderMeshFromData(context.Background(), data, MeshOptions{Resolution: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	winged, err := RenderMeshFromData(context.Background(), data, MeshOptions{Resolution: 32, Overrides: []Override{{"HasWings", 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkClosedManifold(t, "wings", winged)
+	if a, b := meshSize(winged), meshSize(plain); a <= b {
+		t.Errorf("the mesh with wings has size %v, the one without %v", a, b)
+	}
+}
+
+// meshSize returns the sum of the extents of the mesh along the three axes.
+func meshSize(m *Mesh) float64 {
+	min, max := m.Vertices[0], m.Vertices[0]
+	for _, v := range m.Vertices {
+		min, max = minVector(min, v), maxVector(max, v)
+	}
+	size := max.Minus(min)
+	return size[0] + size[1] + size[2]
+}
@@ -0,0 +1,158 @@
+package unicornify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// A MeshFormat is a file format for meshes.
+type MeshFormat string
+
+const (
+	STL  MeshFormat = "stl"
+	OBJ  MeshFormat = "obj"
+	GLTF MeshFormat = "gltf"
+)
+
+// ParseMeshFormat returns the mesh format with the given name, which may also
+// be a file extension like ".stl".
+func ParseMeshFormat(name string) (MeshFormat, error) {
+	switch f := MeshFormat(strings.ToLower(strings.TrimPrefix(name, "."))); f {
+	case STL, OBJ, GLTF:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown mesh format %q; valid formats are stl, obj, and gltf", name)
+}
+
+// Write writes the mesh in the given format.
+func (m *Mesh) Write(w io.Writer, format MeshFormat) error {
+	switch format {
+	case STL:
+		return m.WriteSTL(w)
+	case OBJ:
+		return m.WriteOBJ(w)
+	case GLTF:
+		return m.WriteGLTF(w)
+	}
+	return fmt.Errorf("unknown mesh format %q", format)
+}
+
+// WriteSTL writes the mesh as a binary STL file, which has no colors.
+func (m *Mesh) WriteSTL(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	header := make([]byte, 80)
+	copy(header, "go-unicornify")
+	buf.Write(header)
+	binary.Write(buf, binary.LittleEndian, uint32(len(m.Triangles)))
+	for _, t := range m.Triangles {
+		a, b, c := m.Vertices[t[0]], m.Vertices[t[1]], m.Vertices[t[2]]
+		normal := b.Minus(a).CrossProd(c.Minus(a))
+		if normal.Length() > 0 {
+			normal = normal.Unit()
+		}
+		values := make([]float32, 0, 12)
+		for _, v := range [4][3]float64{normal, a, b, c} {
+			values = append(values, float32(v[0]), float32(v[1]), float32(v[2]))
+		}
+		binary.Write(buf, binary.LittleEndian, values)
+		binary.Write(buf, binary.LittleEndian, uint16(0))
+	}
+	return buf.Flush()
+}
+
+// WriteOBJ writes the mesh as a Wavefront OBJ file, with the vertex colors
+// following the coordinates of each vertex (a common extension of the format).
+func (m *Mesh) WriteOBJ(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "# go-unicornify")
+	for i, v := range m.Vertices {
+		c := m.Colors[i]
+		fmt.Fprintf(buf, "v %.4f %.4f %.4f %.4f %.4f %.4f\n", v[0], v[1], v[2], float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+	}
+	for _, t := range m.Triangles {
+		fmt.Fprintf(buf, "f %d %d %d\n", t[0]+1, t[1]+1, t[2]+1)
+	}
+	return buf.Flush()
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+// WriteGLTF writes the mesh as a glTF 2.0 file with the binary data embedded,
+// with the vertex colors in the COLOR_0 attribute.
+func (m *Mesh) WriteGLTF(w io.Writer) error {
+	const (
+		float        = 5126
+		unsignedInt  = 5125
+		arrayBuffer  = 34962
+		elementArray = 34963
+	)
+
+	var data bytes.Buffer
+	min := []float32{float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(1))}
+	max := []float32{float32(math.Inf(-1)), float32(math.Inf(-1)), float32(math.Inf(-1))}
+	for _, v := range m.Vertices {
+		for i := range min {
+			min[i] = float32(math.Min(float64(min[i]), v[i]))
+			max[i] = float32(math.Max(float64(max[i]), v[i]))
+			binary.Write(&data, binary.LittleEndian, float32(v[i]))
+		}
+	}
+	positionLength := data.Len()
+	for _, c := range m.Colors {
+		binary.Write(&data, binary.LittleEndian, [3]float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255})
+	}
+	colorLength := data.Len() - positionLength
+	for _, t := range m.Triangles {
+		binary.Write(&data, binary.LittleEndian, [3]uint32{uint32(t[0]), uint32(t[1]), uint32(t[2])})
+	}
+	indexLength := data.Len() - positionLength - colorLength
+
+	doc := map[string]interface{}{
+		"asset":  map[string]string{"version": "2.0", "generator": "go-unicornify"},
+		"scene":  0,
+		"scenes": []interface{}{map[string][]int{"nodes": {0}}},
+		"nodes":  []interface{}{map[string]int{"mesh": 0}},
+		"meshes": []interface{}{map[string]interface{}{
+			"primitives": []interface{}{map[string]interface{}{
+				"attributes": map[string]int{"POSITION": 0, "COLOR_0": 1},
+				"indices":    2,
+			}},
+		}},
+		"buffers": []interface{}{map[string]interface{}{
+			"byteLength": data.Len(),
+			"uri":        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(data.Bytes()),
+		}},
+		"bufferViews": []gltfBufferView{
+			{0, 0, positionLength, arrayBuffer},
+			{0, positionLength, colorLength, arrayBuffer},
+			{0, positionLength + colorLength, indexLength, elementArray},
+		},
+		"accessors": []gltfAccessor{
+			{0, float, len(m.Vertices), "VEC3", min, max},
+			{1, float, len(m.Colors), "VEC3", nil, nil},
+			{2, unsignedInt, len(m.Triangles) * 3, "SCALAR", nil, nil},
+		},
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
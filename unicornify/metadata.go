@@ -0,0 +1,230 @@
+package unicornify
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+// Metadata describes how an image was created. EncodeWithMetadata stores it
+// in PNG text chunks, and ReadMetadata reads it back, so that the image can
+// be traced to its origin and rendered again.
+type Metadata struct {
+	Hash    string   // the hash the unicorn was generated from; empty if it was rendered from data
+	Options Options  // the options used for rendering
+	Version string   // the version of the program that created the image
+	Data    *AllData // optionally, the full unicorn data
+}
+
+const (
+	metaKeyHash    = "unicornify:hash"
+	metaKeyOptions = "unicornify:options"
+	metaKeyVersion = "unicornify:version"
+	metaKeyData    = "unicornify:data"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const (
+	// maxChunkLength is the largest chunk length the PNG specification
+	// allows.
+	maxChunkLength = 1<<31 - 1
+	// maxTextLength limits the size of text chunks (after decompression),
+	// which are read into memory. The metadata is only a few kilobytes.
+	maxTextLength = 16 << 20
+)
+
+// EncodeWithMetadata is like Encode, but for PNG images also writes the
+// metadata. Other formats are written without it.
+func EncodeWithMetadata(w io.Writer, img *image.NRGBA, format Format, meta Metadata) error {
+	if format.Name != "png" {
+		return Encode(w, img, format)
+	}
+
+	options, err := json.Marshal(meta.Options)
+	if err != nil {
+		return err
+	}
+	var chunks bytes.Buffer
+	writeChunk(&chunks, "tEXt", textChunk("Software", "go-unicornify "+meta.Version))
+	writeChunk(&chunks, "tEXt", textChunk(metaKeyVersion, meta.Version))
+	if meta.Hash != "" {
+		writeChunk(&chunks, "tEXt", textChunk(metaKeyHash, meta.Hash))
+	}
+	writeChunk(&chunks, "iTXt", itxtChunk(metaKeyOptions, options, false))
+	if meta.Data != nil {
+		data, err := json.Marshal(meta.Data)
+		if err != nil {
+			return err
+		}
+		writeChunk(&chunks, "iTXt", itxtChunk(metaKeyData, data, true))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	encoded := buf.Bytes()
+	// the text chunks go right after the IHDR chunk, which always comes
+	// first and has 13 bytes of data
+	ihdrEnd := len(pngSignature) + 4 + 4 + 13 + 4
+	if _, err := w.Write(encoded[:ihdrEnd]); err != nil {
+		return err
+	}
+	if _, err := w.Write(chunks.Bytes()); err != nil {
+		return err
+	}
+	_, err = w.Write(encoded[ihdrEnd:])
+	return err
+}
+
+func writeChunk(w *bytes.Buffer, typ string, data []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	w.WriteString(typ)
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+func textChunk(keyword, text string) []byte {
+	return []byte(keyword + "\x00" + text)
+}
+
+func itxtChunk(keyword string, text []byte, compress bool) []byte {
+	var b bytes.Buffer
+	b.WriteString(keyword)
+	b.WriteByte(0)
+	if compress {
+		b.Write([]byte{1, 0}) // compressed with zlib
+	} else {
+		b.Write([]byte{0, 0})
+	}
+	b.Write([]byte{0, 0}) // no language tag, no translated keyword
+	if compress {
+		z := zlib.NewWriter(&b)
+		z.Write(text)
+		z.Close()
+	} else {
+		b.Write(text)
+	}
+	return b.Bytes()
+}
+
+// ReadMetadata reads the metadata written by EncodeWithMetadata from a PNG
+// file. It returns an error if the file isn't a PNG or has no metadata.
+func ReadMetadata(r io.Reader) (Metadata, error) {
+	texts, err := readTextChunks(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	options, ok := texts[metaKeyOptions]
+	if !ok {
+		return Metadata{}, errors.New("the file contains no unicornify metadata")
+	}
+
+	meta := Metadata{
+		Hash:    texts[metaKeyHash],
+		Version: texts[metaKeyVersion],
+	}
+	if err := json.Unmarshal([]byte(options), &meta.Options); err != nil {
+		return Metadata{}, fmt.Errorf("invalid options in metadata: %v", err)
+	}
+	if data, ok := texts[metaKeyData]; ok {
+		meta.Data = &AllData{}
+		if err := json.Unmarshal([]byte(data), meta.Data); err != nil {
+			return Metadata{}, fmt.Errorf("invalid unicorn data in metadata: %v", err)
+		}
+	}
+	return meta, nil
+}
+
+// readTextChunks returns the contents of all tEXt and iTXt chunks by keyword.
+func readTextChunks(r io.Reader) (map[string]string, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+
+	texts := make(map[string]string)
+	for {
+		var header struct {
+			Length uint32
+			Type   [4]byte
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return nil, errors.New("truncated PNG file")
+		}
+		if header.Length > maxChunkLength {
+			return nil, errors.New("invalid PNG chunk length")
+		}
+		typ := string(header.Type[:])
+		if typ == "IEND" {
+			return texts, nil
+		}
+		if typ != "tEXt" && typ != "iTXt" {
+			// skip the data and the CRC
+			if _, err := io.CopyN(io.Discard, r, int64(header.Length)+4); err != nil {
+				return nil, errors.New("truncated PNG file")
+			}
+			continue
+		}
+
+		if header.Length > maxTextLength {
+			return nil, errors.New("PNG text chunk is too large")
+		}
+		data := make([]byte, int(header.Length)+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errors.New("truncated PNG file")
+		}
+		data = data[:header.Length]
+		keyword, text, ok := cutAtZero(data)
+		if !ok {
+			continue
+		}
+		if typ == "iTXt" {
+			if len(text) < 2 {
+				continue
+			}
+			compressed := text[0] == 1
+			rest := text[2:]
+			// skip the language tag and the translated keyword
+			_, rest, ok1 := cutAtZero(rest)
+			_, rest, ok2 := cutAtZero(rest)
+			if !ok1 || !ok2 {
+				continue
+			}
+			text = rest
+			if compressed {
+				z, err := zlib.NewReader(bytes.NewReader(text))
+				if err != nil {
+					continue
+				}
+				text, err = io.ReadAll(io.LimitReader(z, maxTextLength+1))
+				if err != nil {
+					continue
+				}
+				if len(text) > maxTextLength {
+					return nil, errors.New("PNG text chunk is too large")
+				}
+			}
+		}
+		texts[string(keyword)] = string(text)
+	}
+}
+
+// cutAtZero splits b at the first zero byte.
+func cutAtZero(b []byte) (before, after []byte, found bool) {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:], true
+	}
+	return b, nil, false
+}
@@ -0,0 +1,136 @@
+package unicornify
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(50 * x), uint8(80 * y), 7, uint8(255 - 40*x)})
+		}
+	}
+	return img
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	data, err := randomize("7daf6c79d4802916d83f6266e24850af", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.Apply([]Override{{"NeckTilt", -30}}); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Width, opts.Height = 5, 3
+	opts.Filter = LanczosFilter
+	opts.Overrides = []Override{{"HornHue", 50}}
+
+	tests := []struct {
+		name string
+		meta Metadata
+	}{
+		{"hash", Metadata{Hash: "7daf6c79d4802916d83f6266e24850af", Options: opts, Version: "1.2.3"}},
+		{"data", Metadata{Options: DefaultOptions(), Version: "dev", Data: &data}},
+		{"both", Metadata{Hash: "ffff", Options: opts, Version: "", Data: &data}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := EncodeWithMetadata(&buf, testImage(), PNG, tt.meta); err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+
+		got, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		if got.Hash != tt.meta.Hash || got.Version != tt.meta.Version {
+			t.Errorf("%v: got hash %q and version %q, want %q and %q", tt.name, got.Hash, got.Version, tt.meta.Hash, tt.meta.Version)
+		}
+		if !reflect.DeepEqual(got.Options, tt.meta.Options) {
+			t.Errorf("%v: got options %+v, want %+v", tt.name, got.Options, tt.meta.Options)
+		}
+		if (got.Data == nil) != (tt.meta.Data == nil) {
+			t.Errorf("%v: got data %v, want %v", tt.name, got.Data, tt.meta.Data)
+		} else if got.Data != nil {
+			gotJSON, _ := json.Marshal(got.Data)
+			wantJSON, _ := json.Marshal(tt.meta.Data)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("%v: got data %s, want %s", tt.name, gotJSON, wantJSON)
+			}
+		}
+
+		// the image itself is unchanged
+		img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		want := testImage()
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 5; x++ {
+				if c := color.NRGBAModel.Convert(img.At(x, y)); c != want.NRGBAAt(x, y) {
+					t.Errorf("%v: pixel (%v,%v) is %v, want %v", tt.name, x, y, c, want.NRGBAAt(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestReadMetadataErrors(t *testing.T) {
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	var withMeta bytes.Buffer
+	if err := EncodeWithMetadata(&withMeta, testImage(), PNG, Metadata{Options: DefaultOptions()}); err != nil {
+		t.Fatal(err)
+	}
+	var jpeg bytes.Buffer
+	if err := EncodeWithMetadata(&jpeg, testImage(), JPEG, Metadata{Options: DefaultOptions()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a chunk header claiming a length beyond what PNG allows, which
+	// mustn't wrap around when the CRC is added
+	header := func(length uint32, typ string) []byte {
+		b := append([]byte{}, pngSignature...)
+		b = append(b, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(pngSignature):], length)
+		return append(append(b, typ...), "unicornify:data\x00{}"...)
+	}
+	var bomb bytes.Buffer
+	z := zlib.NewWriter(&bomb)
+	z.Write(make([]byte, maxTextLength+1))
+	z.Close()
+	var huge bytes.Buffer
+	huge.Write(pngSignature)
+	writeChunk(&huge, "iTXt", append([]byte(metaKeyData+"\x00\x01\x00\x00\x00"), bomb.Bytes()...))
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"empty", nil},
+		{"no metadata", plain.Bytes()},
+		{"jpeg", jpeg.Bytes()},
+		{"truncated", withMeta.Bytes()[:60]},
+		{"wrapping length", header(0xFFFFFFFD, "tEXt")},
+		{"invalid length", header(0x80000000, "IDAT")},
+		{"huge text chunk", header(maxChunkLength, "tEXt")},
+		{"huge compressed text", huge.Bytes()},
+	}
+	for _, tt := range tests {
+		if _, err := ReadMetadata(bytes.NewReader(tt.file)); err == nil {
+			t.Errorf("%v: ReadMetadata succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package unicornify
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+)
+
+// An Override replaces a single value of the data derived from the hash,
+// e.g. Override{"HornHue", 50} for a gold horn. Field is either the full
+// path of the field within AllData ("UnicornData.HornHue") or, for fields
+// of UnicornData and BackgroundData, just the field name ("HornHue").
+// Angles are given in degrees, and switches like HasWings as 0 (off) or 1
+// (on).
+type Override struct {
+	Field string
+	Value float64
+}
+
+// ParseOverride parses an override of the form "HornHue=50".
+func ParseOverride(s string) (Override, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return Override{}, fmt.Errorf("override %q must have the form Field=Value", s)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return Override{}, fmt.Errorf("value of override %q is not a number", s)
+	}
+	return Override{strings.TrimSpace(parts[0]), value}, nil
+}
+
+type overridableField struct {
+	path     string
+	min, max float64
+	degrees  bool // the value is given in degrees, but stored in radians
+	hue      bool // the value is a hue, which wraps around at 360
+}
+
+var overridableFields = []overridableField{
+	{path: "UnicornData.HeadSize", min: 5, max: 80},
+	{path: "UnicornData.SnoutSize", min: 2, max: 60},
+	{path: "UnicornData.ShoulderSize", min: 10, max: 120},
+	{path: "UnicornData.SnoutLength", min: 20, max: 200},
+	{path: "UnicornData.ButtSize", min: 10, max: 120},
+	{path: "UnicornData.BodyHue", min: 0, max: 359, hue: true},
+	{path: "UnicornData.BodySat", min: 0, max: 100},
+	{path: "UnicornData.HornHue", min: 0, max: 359, hue: true},
+	{path: "UnicornData.HornSat", min: 0, max: 100},
+	{path: "UnicornData.HornOnsetSize", min: 1, max: 30},
+	{path: "UnicornData.HornTipSize", min: 0.5, max: 20},
+	{path: "UnicornData.HornLength", min: 0, max: 250},
+	{path: "UnicornData.HornAngle", min: -90, max: 90, degrees: true},
+	{path: "UnicornData.EyeSize", min: 2, max: 30},
+	{path: "UnicornData.PupilSize", min: 0.5, max: 20},
+	{path: "UnicornData.HairHue", min: 0, max: 359, hue: true},
+	{path: "UnicornData.HairSat", min: 0, max: 100},
+	{path: "UnicornData.TailStartSize", min: 1, max: 30},
+	{path: "UnicornData.TailEndSize", min: 1, max: 40},
+	{path: "UnicornData.TailLength", min: 0, max: 300},
+	{path: "UnicornData.TailAngle", min: -90, max: 90, degrees: true},
+	{path: "UnicornData.TailGamma", min: 0.1, max: 10},
+	{path: "UnicornData.BrowSize", min: 0.5, max: 10},
+	{path: "UnicornData.BrowLength", min: 0, max: 10},
+	{path: "UnicornData.BrowMood", min: -1, max: 1},
+	{path: "UnicornData.PoseKindIndex", min: 0, max: float64(len(Poses) - 1)},
+	{path: "UnicornData.PosePhase", min: 0, max: 100}, // the cycle repeats after 1
+	{path: "UnicornData.NeckTilt", min: -90, max: 90, degrees: true},
+	{path: "UnicornData.FaceTilt", min: -90, max: 90, degrees: true},
+	{path: "UnicornData.EarLength", min: 0, max: 80},
+	{path: "UnicornData.HasWings", min: 0, max: 1},
+	{path: "UnicornData.WingHue", min: 0, max: 359, hue: true},
+	{path: "UnicornData.WingSat", min: 0, max: 100},
+	{path: "UnicornData.WingSpan", min: 20, max: 300},
+	{path: "UnicornData.WingLift", min: -45, max: 90, degrees: true},
+	{path: "UnicornData.WingFeatherCount", min: 1, max: 30},
+
+	{path: "BackgroundData.SkyHue", min: 0, max: 359, hue: true},
+	{path: "BackgroundData.SkySat", min: 0, max: 100},
+	{path: "BackgroundData.LandHue", min: 0, max: 359, hue: true},
+	{path: "BackgroundData.LandSat", min: 0, max: 100},
+	{path: "BackgroundData.LandLight", min: 0, max: 100},
+	{path: "BackgroundData.Horizon", min: 0, max: 1},
+	{path: "BackgroundData.RainbowFoot", min: -1, max: 2},
+	{path: "BackgroundData.RainbowDir", min: -1, max: 1},
+	{path: "BackgroundData.RainbowHeight", min: 0, max: 5},
+	{path: "BackgroundData.RainbowBandWidth", min: 0, max: 0.2},
+
+	{path: "Scale", min: 0.5, max: 3},
+	{path: "XAngle", min: -89, max: 89, degrees: true},
+	{path: "YAngle", min: -360, max: 360, degrees: true},
+	{path: "FocalLength", min: 50, max: 2000},
+	{path: "LightDirection.X", min: -100, max: 100},
+	{path: "LightDirection.Y", min: -100, max: 100},
+	{path: "LightDirection.Z", min: -100, max: 100},
+}
+
+// OverridableFields returns the full paths of all fields that can be
+// changed with an Override.
+func OverridableFields() []string {
+	result := make([]string, len(overridableFields))
+	for i, f := range overridableFields {
+		result[i] = f.path
+	}
+	return result
+}
+
+func findOverridableField(name string) (overridableField, bool) {
+	for _, f := range overridableFields {
+		if f.path == name ||
+			strings.TrimPrefix(f.path, "UnicornData.") == name ||
+			strings.TrimPrefix(f.path, "BackgroundData.") == name {
+			return f, true
+		}
+	}
+	return overridableField{}, false
+}
+
+// applyJoint handles overrides of joint rotations, which have the form
+// "Joints.neck.Z" (optionally prefixed with "UnicornData."). It returns false
+// if o isn't such an override.
+func (d *AllData) applyJoint(o Override) (bool, error) {
+	parts := strings.Split(strings.TrimPrefix(o.Field, "UnicornData."), ".")
+	if len(parts) != 3 || parts[0] != "Joints" {
+		return false, nil
+	}
+	j, err := ParseJoint(parts[1])
+	if err != nil {
+		return true, err
+	}
+	if math.IsNaN(o.Value) || o.Value < -180 || o.Value > 180 {
+		return true, fmt.Errorf("%v must be between -180 and 180", o.Field)
+	}
+	if d.UnicornData.Joints == nil {
+		d.UnicornData.Joints = Pose{}
+	}
+	r := d.UnicornData.Joints[j]
+	switch parts[2] {
+	case "X":
+		r.X = o.Value * DEGREE
+	case "Y":
+		r.Y = o.Value * DEGREE
+	case "Z":
+		r.Z = o.Value * DEGREE
+	default:
+		return true, fmt.Errorf("unknown axis %q in %v; must be X, Y, or Z", parts[2], o.Field)
+	}
+	d.UnicornData.Joints[j] = r
+	return true, nil
+}
+
+// Apply changes the data according to the overrides, which are checked for
+// valid field names and values.
+func (d *AllData) Apply(overrides []Override) error {
+	for _, o := range overrides {
+		if ok, err := d.applyJoint(o); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(o.Field, "GrassData.") {
+			// prepare copies the horizon and colors from the background
+			// data, undoing any override, and Wind isn't used yet
+			return fmt.Errorf("%v can't be set; the grass follows the background data, so set Horizon, LandHue, LandSat, or LandLight instead", o.Field)
+		}
+		f, ok := findOverridableField(o.Field)
+		if !ok {
+			return fmt.Errorf("unknown field %q; valid fields are %v, and Joints.<joint>.X/Y/Z", o.Field, strings.Join(OverridableFields(), ", "))
+		}
+		if math.IsNaN(o.Value) || o.Value < f.min || o.Value > f.max {
+			return fmt.Errorf("%v must be between %v and %v", o.Field, f.min, f.max)
+		}
+
+		v := d.fieldValue(f)
+		switch v.Kind() {
+		case reflect.Bool:
+			if o.Value != 0 && o.Value != 1 {
+				return fmt.Errorf("%v must be 0 or 1", o.Field)
+			}
+			v.SetBool(o.Value == 1)
+		case reflect.Int:
+			if o.Value != math.Trunc(o.Value) {
+				return fmt.Errorf("%v must be a whole number", o.Field)
+			}
+			v.SetInt(int64(o.Value))
+		case reflect.Float64:
+			value := o.Value
+			if f.degrees {
+				value *= DEGREE
+			}
+			v.SetFloat(value)
+		default:
+			panic("unhandled field type")
+		}
+	}
+	return nil
+}
+
+// fieldValue returns the settable value of the field within d.
+func (d *AllData) fieldValue(f overridableField) reflect.Value {
+	v := reflect.ValueOf(d).Elem()
+	for _, name := range strings.Split(f.path, ".") {
+		if v.Kind() == reflect.Array {
+			v = v.Index(strings.Index("XYZ", name))
+		} else {
+			v = v.FieldByName(name)
+		}
+	}
+	return v
+}
+
+// isWholeNumberField reports whether overrides of the named field must be
+// whole numbers, like PoseKindIndex or the switch HasWings.
+func isWholeNumberField(name string) bool {
+	f, ok := findOverridableField(name)
+	if !ok {
+		return false
+	}
+	switch (&AllData{}).fieldValue(f).Kind() {
+	case reflect.Bool, reflect.Int:
+		return true
+	}
+	return false
+}
+
+// isHueField reports whether the named field is a hue, i.e. an angle on the
+// color wheel.
+func isHueField(name string) bool {
+	f, ok := findOverridableField(name)
+	return ok && f.hue
+}
@@ -0,0 +1,116 @@
+package unicornify
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+)
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Override
+		wantErr bool
+	}{
+		{"HornHue=50", Override{"HornHue", 50}, false},
+		{" NeckTilt = -12.5 ", Override{"NeckTilt", -12.5}, false},
+		{"LightDirection.X=1e1", Override{"LightDirection.X", 10}, false},
+		{"Joints.neck.Z=-5", Override{"Joints.neck.Z", -5}, false},
+		{"HornHue", Override{}, true},
+		{"=50", Override{}, true},
+		{"HornHue=gold", Override{}, true},
+		{"HornHue=", Override{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOverride(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOverride(%q): error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseOverride(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// applyTest is a single override applied to a randomized unicorn. check
+// tells whether the override had the expected effect.
+type applyTest struct {
+	override Override
+	check    func(d AllData) bool
+	wantErr  bool
+}
+
+func TestApply(t *testing.T) {
+	testApply(t, []applyTest{
+		{Override{"HornHue", 50}, func(d AllData) bool { return d.UnicornData.HornHue == 50 }, false},
+		{Override{"UnicornData.HornHue", 359}, func(d AllData) bool { return d.UnicornData.HornHue == 359 }, false},
+		{Override{"SkyHue", 0}, func(d AllData) bool { return d.BackgroundData.SkyHue == 0 }, false},
+		{Override{"NeckTilt", 30}, func(d AllData) bool { return approx(d.UnicornData.NeckTilt, 30*DEGREE) }, false},
+		{Override{"YAngle", -360}, func(d AllData) bool { return approx(d.YAngle, -2*math.Pi) }, false},
+		{Override{"Scale", 2}, func(d AllData) bool { return d.Scale == 2 }, false},
+		{Override{"LightDirection.Y", -7}, func(d AllData) bool { return d.LightDirection[1] == -7 }, false},
+
+		{Override{"HornHue", 360}, nil, true},
+		{Override{"HornHue", -1}, nil, true},
+		{Override{"HornHue", math.NaN()}, nil, true},
+		{Override{"NeckTilt", 91}, nil, true},
+		{Override{"PoseKindIndex", 1.5}, nil, true},
+		{Override{"NoSuchField", 1}, nil, true},
+		{Override{"GrassData.Wind", 0}, nil, true},
+	})
+}
+
+func TestApplyWings(t *testing.T) {
+	testApply(t, []applyTest{
+		{Override{"HasWings", 1}, func(d AllData) bool { return d.UnicornData.HasWings }, false},
+		{Override{"HasWings", 0}, func(d AllData) bool { return !d.UnicornData.HasWings }, false},
+		{Override{"HasWings", 0.5}, nil, true},
+	})
+}
+
+func TestApplyJoints(t *testing.T) {
+	testApply(t, []applyTest{
+		{Override{"Joints.neck.Z", -30}, func(d AllData) bool { return approx(d.UnicornData.Joints[JointNeck].Z, -30*DEGREE) }, false},
+		{Override{"UnicornData.Joints.tailMid.X", 180}, func(d AllData) bool { return approx(d.UnicornData.Joints[JointTailMid].X, math.Pi) }, false},
+
+		{Override{"Joints.noSuchJoint.Z", 0}, nil, true},
+		{Override{"Joints.neck.W", 0}, nil, true},
+		{Override{"Joints.neck.Z", 181}, nil, true},
+	})
+}
+
+func testApply(t *testing.T, tests []applyTest) {
+	t.Helper()
+	for _, tt := range tests {
+		d, err := randomize("0123456789abcdef0123456789abcdef", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Apply([]Override{tt.override})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Apply(%v): error %v, want error %v", tt.override, err, tt.wantErr)
+			continue
+		}
+		if tt.check != nil && !tt.check(d) {
+			t.Errorf("Apply(%v) didn't set the field as expected", tt.override)
+		}
+	}
+}
+
+func TestOverridableFieldsApply(t *testing.T) {
+	// every listed field can be set to both ends of its range
+	for _, f := range overridableFields {
+		for _, value := range []float64{f.min, f.max} {
+			var d AllData
+			if err := d.Apply([]Override{{f.path, value}}); err != nil {
+				t.Errorf("Apply(%v=%v): %v", f.path, value, err)
+			}
+		}
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
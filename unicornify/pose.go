@@ -1,9 +1,12 @@
 package unicornify
 
 import (
+	"fmt"
 	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
 	"math"
 	"sort"
+	"strings"
 )
 
 type tv struct {
@@ -112,4 +115,138 @@ func Walk(u *Unicorn, phase float64) {
 	bl.Hoof.RotateAround(*bl.Knee, backBottom(phase-.44)*DEGREE, 2)
 }
 
-var Poses = [...]func(*Unicorn, float64){RotatoryGallop, Walk}
+// Poses are all the poses a unicorn can have, indexed by
+// UnicornData.PoseKindIndex. New poses must be added at the end.
+var Poses = [...]func(*Unicorn, float64){RotatoryGallop, Walk, Rear, Stand, Trot, Lie}
+
+// PoseNames are the names of Poses, as accepted by ParsePose.
+var PoseNames = [len(Poses)]string{"gallop", "walk", "rear", "stand", "trot", "lie"}
+
+// randomPoseCount is the number of poses (from the start of Poses) that are
+// chosen from the hash. The poses that were added later have to be selected
+// explicitly, so that existing unicorns keep their pose.
+const randomPoseCount = 2
+
+// ParsePose returns the index in Poses of the pose with the given name.
+func ParsePose(name string) (int, error) {
+	for i, n := range PoseNames {
+		if strings.EqualFold(n, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pose %q; valid poses are %v", name, strings.Join(PoseNames[:], ", "))
+}
+
+// groundY is the height of the hooves' centers when they are on the ground.
+const groundY = 310
+
+// forebody returns the balls that make up the front of the unicorn at the
+// time the pose is applied: head, shoulder, and front legs.
+func (u *Unicorn) forebody() []*Ball {
+	result := []*Ball{
+		u.Head, u.Snout, u.Shoulder, u.HornOnset, u.HornTip,
+		u.EyeLeft, u.EyeRight, u.PupilLeft, u.PupilRight,
+		u.BrowLeftInner, u.BrowLeftMiddle, u.BrowLeftOuter,
+		u.BrowRightInner, u.BrowRightMiddle, u.BrowRightOuter,
+	}
+	for _, f := range []*Figure{u.EarLeft, u.EarRight} {
+		for b := range f.BallSet() {
+			result = append(result, b)
+		}
+	}
+	for _, l := range u.Legs[:2] {
+		result = append(result, l.Hip, l.Knee, l.Hoof)
+	}
+	return result
+}
+
+// Rear lets the unicorn rise onto its hind legs by rotating the front of its
+// body around the butt. The front legs paw the air, with the left and right
+// leg half a cycle apart.
+func Rear(u *Unicorn, phase float64) {
+	fl, fr, bl, br := u.Legs[0], u.Legs[1], u.Legs[2], u.Legs[3]
+
+	angle := 40 * DEGREE
+	for _, b := range u.forebody() {
+		b.RotateAround(*u.Butt, angle, 2)
+	}
+	for _, l := range []Leg{bl, br} {
+		l.Hip.RotateAround(*u.Butt, angle, 2)
+		l.Hoof.Center = Vector{l.Hip.Center.X() - 20, groundY, l.Hoof.Center.Z()}
+	}
+
+	paw := func(l Leg, phase float64) {
+		a := phase * 2 * math.Pi
+		l.Hoof.Center = l.Hip.Center.Plus(Vector{20 + 15*math.Cos(a), 60 + 15*math.Sin(a), 0})
+	}
+	paw(fl, phase)
+	paw(fr, phase-.5)
+}
+
+// Stand puts the unicorn squarely on all four legs, with the hooves below the
+// hips. The phase shifts its weight slightly forwards and backwards.
+func Stand(u *Unicorn, phase float64) {
+	lean := 8 * math.Sin(phase*2*math.Pi)
+	for _, l := range u.Legs {
+		l.Hoof.Center = Vector{l.Hip.Center.X() + lean, groundY, l.Hoof.Center.Z()}
+	}
+}
+
+// Trot moves the diagonal pairs of legs together: the left front leg with the
+// right back leg, and the right front leg with the left back leg. Each hoof
+// moves backwards on the ground for the first half of its cycle and swings
+// forward through the air in the second half, so there are always two hooves
+// on the ground.
+func Trot(u *Unicorn, phase float64) {
+	fl, fr, bl, br := u.Legs[0], u.Legs[1], u.Legs[2], u.Legs[3]
+
+	step := func(l Leg, phase, lift float64) {
+		const stride = 25
+		t := phase - math.Floor(phase)
+		var dx, dy float64
+		if t < .5 {
+			dx = MixFloats(-stride, stride, t/.5)
+		} else {
+			s := (t - .5) / .5
+			dx = MixFloats(stride, -stride, s)
+			dy = -lift * math.Sin(s*math.Pi)
+		}
+		l.Hoof.Center = Vector{l.Hip.Center.X() + dx, groundY + dy, l.Hoof.Center.Z()}
+	}
+	step(fl, phase, 50)
+	step(br, phase, 35)
+	step(fr, phase-.5, 50)
+	step(bl, phase-.5, 35)
+}
+
+// Lie lets the unicorn lie down, with the front legs folded under its chest
+// and the hind legs folded to the side. The phase is ignored.
+func Lie(u *Unicorn, phase float64) {
+	fl, fr, bl, br := u.Legs[0], u.Legs[1], u.Legs[2], u.Legs[3]
+
+	// The front knees point forward, slightly below the hips, and the hooves
+	// are tucked in below them. The front of the body is lowered until the
+	// hooves are on the ground.
+	fold := func(l Leg) Vector {
+		knee := Vector{-math.Sqrt(Sqr(l.CalfLength) - Sqr(20)), 20, 0}
+		return knee.Plus(Vector{0.94, 0.34, 0}.Times(l.ShinLength))
+	}
+	frontDrop := groundY - math.Max(fl.Hip.Center.Y()+fold(fl).Y(), fr.Hip.Center.Y()+fold(fr).Y())
+	for _, b := range u.forebody() {
+		b.Shift(Vector{0, frontDrop, 0})
+	}
+	for _, l := range []Leg{fl, fr} {
+		l.Hoof.Center = l.Hip.Center.Plus(fold(l))
+	}
+
+	// The hind hooves are behind the hips, which makes the knees point
+	// sideways.
+	side := Vector{40, 8, 0}
+	backDrop := groundY - side.Y() - math.Max(bl.Hip.Center.Y(), br.Hip.Center.Y())
+	for _, b := range []*Ball{u.Butt, bl.Hip, bl.Knee, br.Hip, br.Knee} {
+		b.Shift(Vector{0, backDrop, 0})
+	}
+	for _, l := range []Leg{bl, br} {
+		l.Hoof.Center = l.Hip.Center.Plus(side)
+	}
+}
@@ -29,7 +29,7 @@ func (t *DifferenceTracer) Pruned(rp RenderingParameters) Tracer {
 	return SimplyPruned(t, rp) //FIXME
 }
 
-func (t *DifferenceTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *DifferenceTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	return UnDeepifyTrace(t, x, y, ray)
 }
 
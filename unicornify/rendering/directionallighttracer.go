@@ -10,26 +10,26 @@ type DirectionalLightTracer struct {
 	Lighten, Darken    float64
 }
 
-func (t *DirectionalLightTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
-	ok, z, dir, col := t.SourceTracer.Trace(x, y, ray)
+func (t *DirectionalLightTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
+	ok, r := t.SourceTracer.Trace(x, y, ray)
 	if !ok {
-		return ok, z, dir, col
+		return ok, r
 	}
-	dirlen := dir.Length()
+	dirlen := r.Direction.Length()
 	if dirlen == 0 {
-		return ok, z, dir, col
+		return ok, r
 	}
 
-	unit := dir.Times(1 / dirlen)
+	unit := r.Direction.Times(1 / dirlen)
 	sp := unit.ScalarProd(t.LightDirectionUnit)
 
 	if sp >= 0 {
-		col = Darken(col, uint8(sp*t.Darken))
+		r.Color = Darken(r.Color, uint8(sp*t.Darken))
 	} else {
-		col = Lighten(col, uint8(-sp*t.Lighten))
+		r.Color = Lighten(r.Color, uint8(-sp*t.Lighten))
 	}
 
-	return ok, z, dir, col
+	return ok, r
 }
 
 func (t *DirectionalLightTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
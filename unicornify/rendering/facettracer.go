@@ -27,10 +27,10 @@ func (t *FacetTracer) IsEmpty() bool {
 	return t.isEmpty
 }
 
-func (t *FacetTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *FacetTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	facet := t.facets[t.facetNum(x, y)]
 	if facet == nil {
-		return false, 0, NoDirection, Color{}
+		return false, TraceResult{}
 	}
 	return facet.Trace(x, y, ray)
 }
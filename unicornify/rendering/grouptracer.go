@@ -17,11 +17,10 @@ func NewGroupTracer() *GroupTracer {
 	return &GroupTracer{}
 }
 
-func (gt *GroupTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (gt *GroupTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	any := false
 	var minz float64 = 0.0
-	var col Color = Black
-	var dir Vector
+	result := TraceResult{Color: Black}
 	for _, t := range gt.tracers {
 		b := t.GetBounds()
 		if !b.ContainsXY(x, y) {
@@ -36,17 +35,16 @@ func (gt *GroupTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, C
 			}
 			continue
 		}
-		ok, z, thisdir, thiscol := t.Trace(x, y, ray)
-		if ok && z > 0 {
-			if !any || z < minz {
-				col = thiscol
-				minz = z
-				dir = thisdir
+		ok, r := t.Trace(x, y, ray)
+		if ok && r.Z > 0 {
+			if !any || r.Z < minz {
+				result = r
+				minz = r.Z
 				any = true
 			}
 		}
 	}
-	return any, minz, dir, col
+	return any, result
 }
 
 func (t *GroupTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
@@ -12,18 +12,18 @@ type ImageTracer struct {
 	z      func(x, y float64) (bool, float64)
 }
 
-func (t *ImageTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *ImageTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	if !t.bounds.ContainsXY(x, y) {
-		return false, 0, NoDirection, Black
+		return false, TraceResult{}
 	}
 	c := t.img.At(Round(x), Round(y)).(color.RGBA)
 	if c.A < 255 {
-		return false, 0, NoDirection, Black
+		return false, TraceResult{}
 	}
 
 	ok, z := t.z(x, y)
 
-	return ok, z, NoDirection, Color{c.R, c.G, c.B}
+	return ok, TraceResult{Z: z, Direction: NoDirection, Color: Color{R: c.R, G: c.G, B: c.B}, Part: NoPart}
 }
 
 func (t *ImageTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
@@ -27,7 +27,7 @@ func (t *IntersectionTracer) Pruned(rp RenderingParameters) Tracer {
 	return SimplyPruned(t, rp) //FIXME
 }
 
-func (t *IntersectionTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *IntersectionTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	return UnDeepifyTrace(t, x, y, ray)
 }
 
@@ -13,17 +13,18 @@ type PointLightTracer struct {
 	HalfLifes      []float64
 }
 
-func (t *PointLightTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
-	ok, z, dir, col := t.SourceTracer.Trace(x, y, ray)
+func (t *PointLightTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
+	ok, r := t.SourceTracer.Trace(x, y, ray)
 	if !ok {
-		return ok, z, dir, col
+		return ok, r
 	}
-	dirlen := dir.Length()
+	z, col := r.Z, r.Color
+	dirlen := r.Direction.Length()
 	unit := Vector{0, 0, 0}
 	if dirlen > 0 {
-		unit = dir.Times(1 / dirlen)
+		unit = r.Direction.Times(1 / dirlen)
 	} else {
-		return ok, z, dir, col
+		return ok, r
 	}
 
 	lightsum := 0.0
@@ -53,7 +54,8 @@ func (t *PointLightTracer) Trace(x, y float64, ray Vector) (bool, float64, Vecto
 		}
 	}
 
-	return ok, z, dir, col
+	r.Color = col
+	return ok, r
 }
 
 func (t *PointLightTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
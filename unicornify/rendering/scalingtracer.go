@@ -22,12 +22,13 @@ func (t *ScalingTracer) GetBounds() Bounds {
 	return t.bounds
 }
 
-func (t *ScalingTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *ScalingTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	newX := x / t.Scale
 	newY := y / t.Scale
 	newRay := t.wv.Ray(newX, newY)
-	ok, z, dir, col := t.Source.Trace(newX, newY, newRay)
-	return ok, z * t.Scale, dir, col
+	ok, r := t.Source.Trace(newX, newY, newRay)
+	r.Z *= t.Scale
+	return ok, r
 }
 
 func NewScalingTracer(wv WorldView, source Tracer, scale float64) *ScalingTracer {
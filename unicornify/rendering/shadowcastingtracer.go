@@ -14,16 +14,18 @@ type ShadowCastingTracer struct {
 	Lighten, Darken           float64
 }
 
-func (t *ShadowCastingTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
-	ok, z, dir, col := t.SourceTracer.Trace(x, y, ray)
+func (t *ShadowCastingTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
+	ok, r := t.SourceTracer.Trace(x, y, ray)
 	if !ok {
-		return ok, z, dir, col
+		return ok, r
 	}
-	origPoint := t.WorldView.UnProject(Vector{x, y, z})
+	col := r.Color
+	origPoint := t.WorldView.UnProject(Vector{x, y, r.Z})
 	lp := t.LightView.ProjectSphere(origPoint, 0)
 	lx, ly := lp.X(), lp.Y()
 	lray := t.LightView.Ray(lx, ly)
-	lok, lz, ldir, _ := t.LightTracer.Trace(lx, ly, lray)
+	lok, lr := t.LightTracer.Trace(lx, ly, lray)
+	lz, ldir := lr.Z, lr.Direction
 
 	seeing := !lok || lz >= origPoint.Minus(t.LightView.CameraPosition).Length()-0.01
 
@@ -44,7 +46,8 @@ func (t *ShadowCastingTracer) Trace(x, y float64, ray Vector) (bool, float64, Ve
 
 		}
 	}
-	return ok, z, dir, col
+	r.Color = col
+	return ok, r
 }
 
 func (t *ShadowCastingTracer) TraceDeep(x, y float64, ray Vector) (bool, TraceIntervals) {
@@ -23,7 +23,7 @@ func (t *TranslatingTracer) GetBounds() Bounds {
 	return t.bounds
 }
 
-func (t *TranslatingTracer) Trace(x, y float64, ray Vector) (bool, float64, Vector, Color) {
+func (t *TranslatingTracer) Trace(x, y float64, ray Vector) (bool, TraceResult) {
 	newX := x - t.ShiftX
 	newY := y - t.ShiftY
 	newRay := t.wv.Ray(newX, newY)
@@ -0,0 +1,171 @@
+package unicornify
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	pyrand "github.com/balpha/gopyrand"
+)
+
+// AvatarHandler is an http.Handler that serves unicorn avatars under
+// Gravatar-style URLs, e.g.
+//
+//	/avatar/7daf6c79d4802916d83f6266e24850af?s=128&f=1&z=1
+//
+// The images are PNG, unless the hash is followed by a .jpg (or .jpeg),
+// .gif, or .svg extension; SVG images are created with RenderSVG.
+//
+// The query parameters correspond to the command line flags:
+//
+//	s (or size)  the size in pixels (-s)
+//	f            free unicorn with a transparent background (-f)
+//	z            zoom out (-z)
+//	noshading    no shading (-noshading)
+//	nograss      no grass (-nograss)
+//	wings        feathered wings (-wings)
+//	pose         the pose, e.g. rear (-pose)
+//
+// Boolean parameters accept anything strconv.ParseBool does; an empty value
+// (as in "?f") counts as true.
+type AvatarHandler struct {
+	DefaultSize int // the size used if the request doesn't specify one
+	MaxSize     int // requests for larger sizes are rejected
+}
+
+func NewAvatarHandler() *AvatarHandler {
+	return &AvatarHandler{
+		DefaultSize: 128,
+		MaxSize:     2048,
+	}
+}
+
+func (h *AvatarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	const prefix = "/avatar/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	hash := r.URL.Path[len(prefix):]
+	format := PNG
+	if ext := path.Ext(hash); ext != "" {
+		f, err := ParseFormat(ext)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		format = f
+		hash = strings.TrimSuffix(hash, ext)
+	}
+	if hash == "" || strings.Contains(hash, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if err := pyrand.NewRandom().SeedFromHexString(hash); err != nil {
+		http.Error(w, "not a valid hexadecimal number: "+hash, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	size := h.DefaultSize
+	sizeParam := query.Get("s")
+	if sizeParam == "" {
+		sizeParam = query.Get("size")
+	}
+	if sizeParam != "" {
+		s, err := strconv.Atoi(sizeParam)
+		if err != nil || s <= 0 {
+			http.Error(w, "size must be a positive number", http.StatusBadRequest)
+			return
+		}
+		if s > h.MaxSize {
+			http.Error(w, "size must not exceed "+strconv.Itoa(h.MaxSize), http.StatusBadRequest)
+			return
+		}
+		size = s
+	}
+
+	var free, zoomOut, noshading, nograss, wings bool
+	for _, p := range []struct {
+		name  string
+		value *bool
+	}{
+		{"f", &free},
+		{"z", &zoomOut},
+		{"noshading", &noshading},
+		{"nograss", &nograss},
+		{"wings", &wings},
+	} {
+		b, err := boolParam(query, p.name)
+		if err != nil {
+			http.Error(w, "invalid value for parameter "+p.name, http.StatusBadRequest)
+			return
+		}
+		*p.value = b
+	}
+
+	opts := DefaultOptions()
+	opts.Size = size
+	opts.Background = !free
+	opts.ZoomOut = zoomOut
+	opts.Shading = !noshading
+	opts.Grass = !nograss && !free
+	if pose := query.Get("pose"); pose != "" {
+		index, err := ParsePose(pose)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Overrides = append(opts.Overrides, Override{"PoseKindIndex", float64(index)})
+	}
+	if wings {
+		opts.Overrides = append(opts.Overrides, Override{"HasWings", 1})
+	}
+
+	var buf bytes.Buffer
+	if format.Name == "svg" {
+		svg, _, err := RenderSVG(r.Context(), hash, opts)
+		if err != nil {
+			http.Error(w, "error rendering avatar", http.StatusInternalServerError)
+			return
+		}
+		buf.Write(svg)
+	} else {
+		img, _, err := RenderNRGBA(r.Context(), hash, opts)
+		if err != nil {
+			http.Error(w, "error rendering avatar", http.StatusInternalServerError)
+			return
+		}
+		if err := Encode(&buf, img, format); err != nil {
+			http.Error(w, "error encoding image", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+func boolParam(query map[string][]string, name string) (bool, error) {
+	values, ok := query[name]
+	if !ok {
+		return false, nil
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(values[0])
+}
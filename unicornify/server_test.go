@@ -0,0 +1,82 @@
+package unicornify
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAvatarHandler(t *testing.T) {
+	const hash = "7daf6c79d4802916d83f6266e24850af"
+	tests := []struct {
+		method, url string
+		status      int
+		contentType string
+	}{
+		{"GET", "/avatar/" + hash + "?s=32", http.StatusOK, "image/png"},
+		{"GET", "/avatar/" + hash + ".png?size=32&f", http.StatusOK, "image/png"},
+		{"GET", "/avatar/" + hash + ".jpg?s=32&z=1&noshading=true", http.StatusOK, "image/jpeg"},
+		{"GET", "/avatar/" + hash + ".jpeg?s=32&nograss=1&pose=rear", http.StatusOK, "image/jpeg"},
+		{"GET", "/avatar/" + hash + ".gif?s=32&wings=t", http.StatusOK, "image/gif"},
+		{"GET", "/avatar/" + hash + ".svg?s=32", http.StatusOK, "image/svg+xml"},
+		{"HEAD", "/avatar/" + hash + "?s=32", http.StatusOK, "image/png"},
+
+		{"GET", "/avatar/xyz", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=0", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=-5", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=4096", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=big", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=32&f=maybe", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=32&z=2", http.StatusBadRequest, ""},
+		{"GET", "/avatar/" + hash + "?s=32&pose=fly", http.StatusBadRequest, ""},
+
+		{"GET", "/avatar/", http.StatusNotFound, ""},
+		{"GET", "/avatar/" + hash + ".bmp", http.StatusNotFound, ""},
+		{"GET", "/other/" + hash, http.StatusNotFound, ""},
+
+		{"POST", "/avatar/" + hash, http.StatusMethodNotAllowed, ""},
+		{"PUT", "/avatar/" + hash, http.StatusMethodNotAllowed, ""},
+	}
+	handler := NewAvatarHandler()
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%v %v: status %v, want %v", tt.method, tt.url, rec.Code, tt.status)
+			continue
+		}
+		if tt.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%v %v: Allow header %q", tt.method, tt.url, rec.Header().Get("Allow"))
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%v %v: content type %q, want %q", tt.method, tt.url, got, tt.contentType)
+		}
+		body := rec.Body.Bytes()
+		if tt.method == "HEAD" {
+			if len(body) != 0 {
+				t.Errorf("%v %v: the response has a body", tt.method, tt.url)
+			}
+			continue
+		}
+		if tt.contentType == "image/svg+xml" {
+			if !bytes.Contains(body, []byte("<svg")) {
+				t.Errorf("%v %v: the response is not an SVG image", tt.method, tt.url)
+			}
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("%v %v: %v", tt.method, tt.url, err)
+		} else if img.Bounds().Dx() != 32 || img.Bounds().Dy() != 32 {
+			t.Errorf("%v %v: image size %v", tt.method, tt.url, img.Bounds())
+		}
+	}
+}
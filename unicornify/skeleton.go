@@ -0,0 +1,210 @@
+package unicornify
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
+)
+
+// A JointName names a point of the unicorn's skeleton; rotating a joint moves
+// all the parts beyond it (e.g. the neck moves the whole head and the mane).
+type JointName string
+
+const (
+	JointNeck           JointName = "neck"
+	JointHead           JointName = "head"
+	JointTailRoot       JointName = "tailRoot"
+	JointTailMid        JointName = "tailMid"
+	JointFrontLeftHip   JointName = "frontLeftHip"
+	JointFrontLeftKnee  JointName = "frontLeftKnee"
+	JointFrontRightHip  JointName = "frontRightHip"
+	JointFrontRightKnee JointName = "frontRightKnee"
+	JointBackLeftHip    JointName = "backLeftHip"
+	JointBackLeftKnee   JointName = "backLeftKnee"
+	JointBackRightHip   JointName = "backRightHip"
+	JointBackRightKnee  JointName = "backRightKnee"
+)
+
+// legJoints are the hip and knee joints of each of Unicorn.Legs.
+var legJoints = [4][2]JointName{
+	{JointFrontLeftHip, JointFrontLeftKnee},
+	{JointFrontRightHip, JointFrontRightKnee},
+	{JointBackLeftHip, JointBackLeftKnee},
+	{JointBackRightHip, JointBackRightKnee},
+}
+
+// Joints are all the joints of the skeleton, with every joint listed before
+// its parent. This is the order in which Skeleton.Apply rotates them, so the
+// rotation of a joint is relative to its parent.
+var Joints = []JointName{
+	JointHead, JointNeck,
+	JointTailMid, JointTailRoot,
+	JointFrontLeftKnee, JointFrontLeftHip,
+	JointFrontRightKnee, JointFrontRightHip,
+	JointBackLeftKnee, JointBackLeftHip,
+	JointBackRightKnee, JointBackRightHip,
+}
+
+// ParseJoint returns the joint with the given name.
+func ParseJoint(name string) (JointName, error) {
+	for _, j := range Joints {
+		if string(j) == name {
+			return j, nil
+		}
+	}
+	names := make([]string, len(Joints))
+	for i, j := range Joints {
+		names[i] = string(j)
+	}
+	return "", fmt.Errorf("unknown joint %q; valid joints are %v", name, strings.Join(names, ", "))
+}
+
+// A Rotation turns the parts beyond a joint around it. The angles (in
+// radians) are applied around the x axis (which points from the head to the
+// tail), then the y axis (pointing down), then the z axis (pointing to the
+// unicorn's right). Positive Z angles raise the parts in front of the joint
+// and lower the ones behind it.
+type Rotation struct {
+	X, Y, Z float64
+}
+
+// A Pose sets the rotations of some of the unicorn's joints. It's plain data,
+// so poses can be stored in data files or interpolated for animations.
+type Pose map[JointName]Rotation
+
+// A Skeleton gives access to the joints of a unicorn.
+type Skeleton struct {
+	u *Unicorn
+}
+
+// Skeleton returns the unicorn's skeleton.
+func (u *Unicorn) Skeleton() Skeleton {
+	return Skeleton{u}
+}
+
+// Pivot returns the ball around which the joint rotates.
+func (s Skeleton) Pivot(j JointName) *Ball {
+	u := s.u
+	switch j {
+	case JointNeck:
+		return u.Shoulder
+	case JointHead:
+		return u.Head
+	case JointTailRoot:
+		return u.TailStart
+	case JointTailMid:
+		s.splitTail()
+		return u.TailMid
+	}
+	for i, lj := range legJoints {
+		if j == lj[0] {
+			return u.Legs[i].Hip
+		}
+		if j == lj[1] {
+			return u.Legs[i].Knee
+		}
+	}
+	panic("unknown joint " + string(j))
+}
+
+// Balls returns the balls that move when the joint is rotated.
+func (s Skeleton) Balls(j JointName) []*Ball {
+	u := s.u
+	var result []*Ball
+	addAll := func(things ...Thing) {
+		f := &Figure{}
+		f.Add(things...)
+		for b := range f.BallSet() {
+			result = append(result, b)
+		}
+	}
+	switch j {
+	case JointNeck:
+		addAll(u.face, u.Head, u.Hairs)
+		return result
+	case JointHead:
+		addAll(u.face)
+		return result
+	case JointTailRoot:
+		if u.TailMid != nil {
+			result = append(result, u.TailMid)
+		}
+		return append(result, u.TailEnd)
+	case JointTailMid:
+		s.splitTail()
+		return []*Ball{u.TailEnd}
+	}
+	for i, lj := range legJoints {
+		if j == lj[0] {
+			return []*Ball{u.Legs[i].Knee, u.Legs[i].Hoof}
+		}
+		if j == lj[1] {
+			return []*Ball{u.Legs[i].Hoof}
+		}
+	}
+	panic("unknown joint " + string(j))
+}
+
+// Rotate rotates the parts beyond the joint.
+func (s Skeleton) Rotate(j JointName, r Rotation) {
+	pivot := *s.Pivot(j)
+	for _, b := range s.Balls(j) {
+		for axis, angle := range [3]float64{r.X, r.Y, r.Z} {
+			if angle != 0 {
+				b.RotateAround(pivot, angle, byte(axis))
+			}
+		}
+	}
+}
+
+// Apply rotates the joints according to the pose, children before parents.
+// Like the pose functions in Poses, it only determines where the hooves of
+// the rotated legs end up; the knees are then placed by Leg.MoveHoofTo.
+func (s Skeleton) Apply(p Pose) {
+	for _, j := range Joints {
+		if r, ok := p[j]; ok && r != (Rotation{}) {
+			s.Rotate(j, r)
+		}
+	}
+	for i, lj := range legJoints {
+		if p[lj[0]] != (Rotation{}) || p[lj[1]] != (Rotation{}) {
+			s.u.Legs[i].MoveHoofTo(s.u.Legs[i].Hoof.Center)
+		}
+	}
+}
+
+// splitTail turns the tail into two bones, so that it can bend in the middle.
+func (s Skeleton) splitTail() {
+	u := s.u
+	if u.TailMid != nil {
+		return
+	}
+	start, end := u.TailStart, u.TailEnd
+	u.TailMid = NewBallP(
+		start.Center.Plus(end.Center.Minus(start.Center).Times(0.5)),
+		(start.Radius+end.Radius)/2,
+		MixColors(start.Color, end.Color, 0.5),
+	)
+	u.TailMid.Part = start.Part
+	u.Tail.Balls[1] = u.TailMid
+	u.Add(NewNonLinBone(u.TailMid, end, u.Tail.XFunc, u.Tail.YFunc))
+}
+
+// jointPose returns the rotations of the unicorn's joints: the neck and face
+// tilt, plus whatever is given in Joints.
+func (d UnicornData) jointPose() Pose {
+	pose := Pose{
+		JointHead: {X: d.FaceTilt},
+		JointNeck: {Y: d.NeckTilt},
+	}
+	for j, r := range d.Joints {
+		sum := pose[j]
+		sum.X += r.X
+		sum.Y += r.Y
+		sum.Z += r.Z
+		pose[j] = sum
+	}
+	return pose
+}
@@ -0,0 +1,336 @@
+package unicornify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
+)
+
+// RenderSVG is like Render, but creates a vector image. Every ball and bone of
+// the unicorn is projected into a circle or capsule shape with a gradient fill,
+// and the shapes are painted from back to front. This is an approximation:
+// shapes that intersect each other in space can't be sorted correctly, holes
+// in the ears are not cut out, shadows aren't cast, and the grass is omitted.
+// The background is drawn from SVG primitives as well. LinearLight only sets
+// the color-interpolation property, which applies to gradients; overlapping
+// shapes and the shading on top of them are still blended in sRGB.
+// Antialiasing, Filter, Concurrency, Progress, and the map callbacks in opts
+// are ignored.
+func RenderSVG(ctx context.Context, hash string, opts Options) ([]byte, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	allData, err := randomize(hash, opts.ZoomOut)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	if err := allData.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	svg, err := renderSVG(ctx, allData, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return svg, allData, nil
+}
+
+// RenderSVGFromData is like RenderFromData, but creates a vector image; see
+// RenderSVG.
+func RenderSVGFromData(ctx context.Context, data AllData, opts Options) ([]byte, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if opts.ZoomOut {
+		data.Scale = .5
+	}
+	svg, err := renderSVG(ctx, data, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return svg, data, nil
+}
+
+// svgShape is a single shape of the unicorn. geometry is an SVG element that
+// is still missing its fill attribute and the closing "/>".
+type svgShape struct {
+	depth    float64
+	geometry string
+	fill     string
+}
+
+// svgBuilder collects the definitions (gradients etc.) and the shapes of an
+// SVG image.
+type svgBuilder struct {
+	sc        *scene
+	defs      bytes.Buffer
+	shapes    []svgShape
+	gradients int
+}
+
+func renderSVG(ctx context.Context, allData AllData, opts Options) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	allData.prepare()
+	width, height := opts.dimensions()
+	sb := &svgBuilder{sc: newScene(allData, width, height)}
+
+	var body bytes.Buffer
+	if opts.Background {
+		sb.background(&body, opts.Shading)
+	}
+
+	sb.collect(&sb.sc.uni.Figure)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// paint from back to front
+	sort.SliceStable(sb.shapes, func(i, j int) bool {
+		return sb.shapes[i].depth > sb.shapes[j].depth
+	})
+
+	shade := ""
+	if opts.Shading {
+		shade = sb.shadeGradient()
+	}
+	for _, s := range sb.shapes {
+		fmt.Fprintf(&body, "%v fill=\"%v\"/>\n", s.geometry, s.fill)
+		if shade != "" {
+			fmt.Fprintf(&body, "%v fill=\"%v\"/>\n", s.geometry, shade)
+		}
+	}
+
+	var result bytes.Buffer
+	fmt.Fprintf(&result, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\"", width, height, width, height)
+	if opts.LinearLight {
+		result.WriteString(" color-interpolation=\"linearRGB\"")
+	}
+	result.WriteString(">\n<defs>\n")
+	result.Write(sb.defs.Bytes())
+	result.WriteString("</defs>\n")
+	result.Write(body.Bytes())
+	result.WriteString("</svg>\n")
+	return result.Bytes(), nil
+}
+
+// background draws sky, land, rainbow, and clouds the same way
+// BackgroundData.Draw does.
+func (sb *svgBuilder) background(body *bytes.Buffer, shading bool) {
+	d := sb.sc.data.BackgroundData
+	width, height := sb.sc.width, sb.sc.height
+	fwidth, fheight := float64(width-1), float64(height-1)
+	fsize := math.Min(fwidth, fheight)
+	horizon := int(float64(height) * d.Horizon)
+
+	sky := sb.linearGradient(0, 0, 0, fheight, d.Color("Sky", 60), d.Color("Sky", 10))
+	fmt.Fprintf(body, "<rect x=\"0\" y=\"0\" width=\"%d\" height=\"%d\" fill=\"%v\"/>\n", width, horizon, sky)
+	land := sb.linearGradient(0, 0, fwidth, 0, d.Color("Land", d.LandLight), d.Color("Land", d.LandLight/2))
+	fmt.Fprintf(body, "<rect x=\"0\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%v\"/>\n", horizon, width, height-horizon, land)
+
+	fmt.Fprintf(&sb.defs, "<clipPath id=\"sky\"><rect x=\"0\" y=\"0\" width=\"%d\" height=\"%d\"/></clipPath>\n", width, horizon)
+	bandWidth := d.RainbowBandWidth * fsize
+	r := d.RainbowHeight * fsize
+	cx := fwidth*d.RainbowFoot + d.RainbowDir*r // see drawRainbowAndClouds
+	body.WriteString("<g clip-path=\"url(#sky)\" fill=\"none\">\n")
+	for i := 0; i < 7; i++ {
+		fmt.Fprintf(body, "<circle cx=\"%.2f\" cy=\"%d\" r=\"%.2f\" stroke=\"%v\" stroke-width=\"%.2f\"/>\n",
+			cx, horizon, r-(float64(i)+.5)*bandWidth, hexColor(Hsl2col(i*45, 100, 50)), bandWidth)
+	}
+	body.WriteString("</g>\n")
+
+	for i, pos := range d.CloudPositions {
+		x, y := fwidth*pos[0], fheight*pos[1]
+		size1 := fsize * d.CloudSizes[i][0]
+		size2 := size1 * d.CloudSizes[i][1]
+		col := d.Color("Sky", d.CloudLightnesses[i])
+		fill := hexColor(col)
+		if shading {
+			fill = sb.linearGradient(0, y-size1-size2, 0, y, Lighten(col, 32), Darken(col, 16))
+		}
+		fmt.Fprintf(body, "<g fill=\"%v\">\n", fill)
+		fmt.Fprintf(body, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\"/>\n", x-2*size1, y-size1, size1)
+		fmt.Fprintf(body, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\"/>\n", x+2*size1, y-size1, size1)
+		fmt.Fprintf(body, "<path d=\"M%.2f %.2fA%.2f %.2f 0 0 1 %.2f %.2fZ\"/>\n", x-size2, y-size1, size2, size2, x+size2, y-size1)
+		fmt.Fprintf(body, "<rect x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\"/>\n", x-2*size1, y-size1-1, 4*size1, size1+1)
+		body.WriteString("</g>\n")
+	}
+}
+
+// linearGradient adds a gradient from c1 at (x1, y1) to c2 at (x2, y2) (in
+// image coordinates) to the definitions and returns a reference to it.
+func (sb *svgBuilder) linearGradient(x1, y1, x2, y2 float64, c1, c2 Color) string {
+	id := fmt.Sprintf("g%d", sb.gradients)
+	sb.gradients++
+	fmt.Fprintf(&sb.defs, "<linearGradient id=\"%v\" gradientUnits=\"userSpaceOnUse\" x1=\"%.2f\" y1=\"%.2f\" x2=\"%.2f\" y2=\"%.2f\">", id, x1, y1, x2, y2)
+	fmt.Fprintf(&sb.defs, "<stop offset=\"0\" stop-color=\"%v\"/><stop offset=\"1\" stop-color=\"%v\"/></linearGradient>\n", hexColor(c1), hexColor(c2))
+	return "url(#" + id + ")"
+}
+
+// shadeGradient adds the gradient that is laid over every shape to make it
+// lighter on the side facing the light and darker on the other side, and
+// returns a reference to it. The strengths match those of the directional
+// light used for raster images.
+func (sb *svgBuilder) shadeGradient() string {
+	wv := sb.sc.wv
+	p := Vector{0, 0, 1000}
+	pp := wv.ProjectSphere(p, 0).CenterCS
+	ldp := wv.ProjectSphere(p.Plus(sb.sc.data.LightDirection), 0).CenterCS.Minus(pp)
+	dx, dy := ldp.X(), ldp.Y()
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return ""
+	}
+	dx, dy = dx/l, dy/l
+	fmt.Fprintf(&sb.defs, "<linearGradient id=\"shade\" x1=\"%.3f\" y1=\"%.3f\" x2=\"%.3f\" y2=\"%.3f\">", .5-.5*dx, .5-.5*dy, .5+.5*dx, .5+.5*dy)
+	fmt.Fprintf(&sb.defs, "<stop offset=\"0\" stop-color=\"#ffffff\" stop-opacity=\"%.3f\"/>", 32.0/255)
+	sb.defs.WriteString("<stop offset=\"0.5\" stop-color=\"#808080\" stop-opacity=\"0\"/>")
+	fmt.Fprintf(&sb.defs, "<stop offset=\"1\" stop-color=\"#000000\" stop-opacity=\"%.3f\"/></linearGradient>\n", 80.0/255)
+	return "url(#shade)"
+}
+
+// project returns the position and radius of the ball in image coordinates,
+// and its depth. ok is false if the ball is behind the camera.
+func (sb *svgBuilder) project(b *Ball) (x, y, r, depth float64, ok bool) {
+	sc := sb.sc
+	p := sc.wv.ProjectSphere(b.Center, b.Radius)
+	if p.CenterCS.Z() <= 0 {
+		return 0, 0, 0, 0, false
+	}
+	return p.X()*sc.scale + sc.shift[0], p.Y()*sc.scale + sc.shift[1], p.ProjectedRadius * sc.scale, p.CenterCS.Z(), true
+}
+
+// collect adds the shapes for t and everything it consists of. Things that
+// have no SVG shape (like half-spaces) are skipped.
+func (sb *svgBuilder) collect(t Thing) {
+	switch t := t.(type) {
+	case *Ball:
+		sb.addBall(t)
+	case *Bone:
+		for _, seg := range t.Segments(sb.sc.wv, 64) {
+			sb.addCapsule(seg[0], seg[1])
+		}
+	case *Figure:
+		for _, th := range t.Things() {
+			sb.collect(th)
+		}
+	case *Steak:
+		sb.addSteak(t)
+	case *Intersection:
+		// the other thing usually only trims the base a little
+		sb.collect(t.Base)
+	case *Difference:
+		sb.collect(t.Base)
+	default:
+		// nothing to draw
+	}
+}
+
+func (sb *svgBuilder) addBall(b *Ball) {
+	x, y, r, depth, ok := sb.project(b)
+	if !ok {
+		return
+	}
+	sb.shapes = append(sb.shapes, svgShape{
+		depth:    depth,
+		geometry: fmt.Sprintf("<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\"", x, y, r),
+		fill:     hexColor(b.Color),
+	})
+}
+
+// addCapsule adds the outline of the two balls and the two lines tangent to
+// both of them.
+func (sb *svgBuilder) addCapsule(b1, b2 *Ball) {
+	x1, y1, r1, depth1, ok1 := sb.project(b1)
+	x2, y2, r2, depth2, ok2 := sb.project(b2)
+	if !ok1 || !ok2 {
+		return
+	}
+	dx, dy := x2-x1, y2-y1
+	d := math.Hypot(dx, dy)
+	if d <= math.Abs(r1-r2) {
+		// one circle contains the other
+		if r2 > r1 {
+			b1 = b2
+		}
+		sb.addBall(b1)
+		return
+	}
+	theta := math.Atan2(dy, dx)
+	alpha := math.Acos((r1 - r2) / d)
+	point := func(x, y, r, angle float64) (float64, float64) {
+		return x + r*math.Cos(angle), y + r*math.Sin(angle)
+	}
+	flag := func(large bool) int {
+		if large {
+			return 1
+		}
+		return 0
+	}
+	ax, ay := point(x1, y1, r1, theta+alpha)
+	bx, by := point(x1, y1, r1, theta-alpha)
+	cx, cy := point(x2, y2, r2, theta-alpha)
+	ex, ey := point(x2, y2, r2, theta+alpha)
+	path := fmt.Sprintf("<path d=\"M%.2f %.2fA%.2f %.2f 0 %d 1 %.2f %.2fL%.2f %.2fA%.2f %.2f 0 %d 1 %.2f %.2fZ\"",
+		ax, ay, r1, r1, flag(alpha < math.Pi/2), bx, by,
+		cx, cy, r2, r2, flag(alpha > math.Pi/2), ex, ey)
+
+	fill := hexColor(b1.Color)
+	if b1.Color != b2.Color {
+		fill = sb.linearGradient(x1, y1, x2, y2, b1.Color, b2.Color)
+	}
+	sb.shapes = append(sb.shapes, svgShape{
+		depth:    (depth1 + depth2) / 2,
+		geometry: path,
+		fill:     fill,
+	})
+}
+
+// addSteak adds the steak as a flat polygon, with rounded edges if requested.
+func (sb *svgBuilder) addSteak(s *Steak) {
+	b1, b2, b3 := s.Balls[0], s.Balls[1], s.Balls[2]
+	corners := []*Ball{b1, b2, b3}
+	if s.FourCorners {
+		b4 := NewBallP(b2.Center.Plus(b3.Center.Minus(b1.Center)), b1.Radius, s.FourthColor)
+		corners = []*Ball{b1, b2, b4, b3}
+	}
+
+	var points bytes.Buffer
+	depth := 0.0
+	var r, g, b float64
+	for _, c := range corners {
+		x, y, _, cdepth, ok := sb.project(c)
+		if !ok {
+			return
+		}
+		fmt.Fprintf(&points, "%.2f,%.2f ", x, y)
+		depth += cdepth
+		r, g, b = r+float64(c.Color.R), g+float64(c.Color.G), b+float64(c.Color.B)
+	}
+	n := float64(len(corners))
+	sb.shapes = append(sb.shapes, svgShape{
+		depth:    depth / n,
+		geometry: fmt.Sprintf("<polygon points=\"%v\"", bytes.TrimSpace(points.Bytes())),
+		fill:     hexColor(Color{R: uint8(r/n + .5), G: uint8(g/n + .5), B: uint8(b/n + .5)}),
+	})
+	if s.Rounded {
+		for i := range corners {
+			sb.addCapsule(corners[i], corners[(i+1)%len(corners)])
+		}
+	}
+}
+
+// hexColor returns the color in the form #rrggbb.
+func hexColor(c Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,26 @@
+package unicornify
+
+import (
+	"testing"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+	. "github.com/balpha/go-unicornify/unicornify/elements"
+)
+
+func TestSVGSkipsUndrawableThings(t *testing.T) {
+	data, err := randomize("ffff", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.prepare()
+	sb := &svgBuilder{sc: newScene(data, 100, 100)}
+
+	ball := NewBall(0, 0, 0, 10, Color{})
+	half := NewHalfSpace(Vector{0, 0, 0}, Vector{0, 0, 1})
+	var fig Figure
+	fig.Add(half, ball, NewIntersection(half, ball))
+	sb.collect(&fig)
+	if len(sb.shapes) != 1 {
+		t.Errorf("got %v shapes, want 1", len(sb.shapes))
+	}
+}
@@ -0,0 +1,278 @@
+package unicornify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+// DefaultFPS is the frame rate of a Timeline that doesn't set one.
+const DefaultFPS = 24
+
+// A Timeline describes an animation by keyframes. Every keyframe sets some
+// values of the unicorn data, using the same field names and units as an
+// Override (e.g. "NeckTilt" in degrees, or "Joints.tailMid.Z"). Between two
+// keyframes that set a field, its value is interpolated (hues the short way
+// around the color wheel); before the first and after the last of them, it
+// stays the same. Fields that no keyframe sets keep the value derived from
+// the hash (or given in the data).
+//
+// Timelines are usually read from JSON files with ParseTimeline:
+//
+//	{
+//	  "FPS": 24,
+//	  "Keyframes": [
+//	    {"Frame": 0, "Set": {"PosePhase": 0, "NeckTilt": 0}},
+//	    {"Frame": 48, "Set": {"PosePhase": 2, "NeckTilt": 30}, "Easing": "smooth"}
+//	  ]
+//	}
+type Timeline struct {
+	// FPS is the number of frames per second; it defaults to DefaultFPS.
+	FPS int `json:",omitempty"`
+	// Frames is the number of frames; it defaults to one more than the
+	// number of the last keyframe.
+	Frames int `json:",omitempty"`
+	// Keyframes are sorted by frame number by ParseTimeline and Validate.
+	Keyframes []Keyframe
+}
+
+// A Keyframe sets values of the unicorn data at one frame of a Timeline.
+type Keyframe struct {
+	// Frame is the number of the frame, starting at 0.
+	Frame int
+	// Set maps field names to their values at this frame.
+	Set map[string]float64
+	// Easing determines how the values change from the previous keyframe
+	// to this one: "linear" (the default), "smooth" (slowly starting and
+	// stopping), or "step" (keeping the previous values until this frame).
+	Easing string `json:",omitempty"`
+}
+
+// ParseTimeline reads a timeline in JSON format and validates it.
+func ParseTimeline(r io.Reader) (*Timeline, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	t := &Timeline{}
+	if err := dec.Decode(t); err != nil {
+		return nil, fmt.Errorf("invalid timeline: %v", err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Validate checks the field names, values, and frame numbers of the timeline,
+// sorts the keyframes, and fills in the defaults for FPS and Frames.
+func (t *Timeline) Validate() error {
+	if len(t.Keyframes) == 0 {
+		return errors.New("timeline must have at least one keyframe")
+	}
+	if t.FPS < 0 {
+		return errors.New("timeline FPS must be a positive number")
+	}
+	if t.FPS == 0 {
+		t.FPS = DefaultFPS
+	}
+	sort.SliceStable(t.Keyframes, func(i, j int) bool {
+		return t.Keyframes[i].Frame < t.Keyframes[j].Frame
+	})
+	for i, k := range t.Keyframes {
+		if k.Frame < 0 {
+			return fmt.Errorf("keyframe %v: frame number must not be negative", k.Frame)
+		}
+		if i > 0 && t.Keyframes[i-1].Frame == k.Frame {
+			return fmt.Errorf("keyframe %v: there are several keyframes for this frame", k.Frame)
+		}
+		switch k.Easing {
+		case "", "linear", "smooth", "step":
+		default:
+			return fmt.Errorf("keyframe %v: unknown easing %q; must be linear, smooth, or step", k.Frame, k.Easing)
+		}
+		var scratch AllData
+		if err := scratch.Apply(k.overrides()); err != nil {
+			return fmt.Errorf("keyframe %v: %v", k.Frame, err)
+		}
+	}
+	last := t.Keyframes[len(t.Keyframes)-1].Frame
+	if t.Frames < 0 {
+		return errors.New("timeline frame count must be a positive number")
+	}
+	if t.Frames == 0 {
+		t.Frames = last + 1
+	}
+	return nil
+}
+
+// overrides returns the values set by the keyframe, sorted by field name so
+// that they're always applied in the same order.
+func (k Keyframe) overrides() []Override {
+	result := make([]Override, 0, len(k.Set))
+	for field, value := range k.Set {
+		result = append(result, Override{field, value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Field < result[j].Field
+	})
+	return result
+}
+
+// ease maps the progress t (between 0 and 1) from one keyframe to the next
+// according to the easing of the next one.
+func ease(easing string, t float64) float64 {
+	switch easing {
+	case "smooth":
+		return t * t * (3 - 2*t)
+	case "step":
+		return 0
+	}
+	return t
+}
+
+// Overrides returns the values the timeline sets at the given frame.
+func (t *Timeline) Overrides(frame int) []Override {
+	type segment struct {
+		prev, next *Keyframe
+	}
+	fields := map[string]*segment{}
+	var names []string
+	for i := range t.Keyframes {
+		k := &t.Keyframes[i]
+		for field := range k.Set {
+			s, ok := fields[field]
+			if !ok {
+				s = &segment{}
+				fields[field] = s
+				names = append(names, field)
+			}
+			if k.Frame <= frame {
+				s.prev = k
+			} else if s.next == nil {
+				s.next = k
+			}
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]Override, 0, len(names))
+	for _, field := range names {
+		s := fields[field]
+		var value float64
+		switch {
+		case s.prev == nil:
+			value = s.next.Set[field]
+		case s.next == nil:
+			value = s.prev.Set[field]
+		default:
+			a, b := s.prev.Set[field], s.next.Set[field]
+			hue := isHueField(field)
+			if hue {
+				// go the short way around the color wheel, e.g. from 350
+				// to 10 through 0 rather than through 180
+				b = a + math.Mod(math.Mod(b-a, 360)+540, 360) - 180
+			}
+			progress := float64(frame-s.prev.Frame) / float64(s.next.Frame-s.prev.Frame)
+			value = a + (b-a)*ease(s.next.Easing, progress)
+			if isWholeNumberField(field) {
+				value = math.Round(value)
+			}
+			if hue {
+				value = math.Mod(math.Mod(value, 360)+360, 360)
+			}
+		}
+		result = append(result, Override{field, value})
+	}
+	return result
+}
+
+// FrameData returns the unicorn data for the given frame, i.e. data changed by
+// the values the timeline sets at that frame.
+func (t *Timeline) FrameData(data AllData, frame int) (AllData, error) {
+	if data.UnicornData.Joints != nil {
+		// Apply changes the joints in place, and data must stay the same
+		joints := make(Pose, len(data.UnicornData.Joints))
+		for j, r := range data.UnicornData.Joints {
+			joints[j] = r
+		}
+		data.UnicornData.Joints = joints
+	}
+	if err := data.Apply(t.Overrides(frame)); err != nil {
+		return AllData{}, fmt.Errorf("frame %v: %v", frame, err)
+	}
+	if err := data.validate(); err != nil {
+		return AllData{}, fmt.Errorf("frame %v: %v", frame, err)
+	}
+	return data, nil
+}
+
+// RenderTimeline renders all frames of the timeline for the unicorn with the
+// given hash (see Render), calling frame with each of them (and the data it
+// was drawn from) in order. The overrides in opts are applied before those of
+// the timeline. Since the scene setup is shared, this is faster than rendering
+// the frames one by one, and since only one frame is kept at a time,
+// animations of any length can be rendered. The returned AllData is that of
+// the first frame.
+func RenderTimeline(ctx context.Context, hash string, t *Timeline, opts Options, frame func(i int, img *image.NRGBA, data AllData) error) (AllData, error) {
+	if err := opts.validate(); err != nil {
+		return AllData{}, err
+	}
+	allData, err := randomize(hash, opts.ZoomOut)
+	if err != nil {
+		return AllData{}, err
+	}
+	if err := allData.Apply(opts.Overrides); err != nil {
+		return AllData{}, err
+	}
+	return renderTimeline(ctx, allData, t, opts, frame)
+}
+
+// RenderTimelineFromData is like RenderTimeline, but for the unicorn described
+// by data. If opts.ZoomOut is set, it overrides data.Scale. The returned
+// AllData is that of the first frame, with the overrides in opts and those of
+// the timeline applied.
+func RenderTimelineFromData(ctx context.Context, data AllData, t *Timeline, opts Options, frame func(i int, img *image.NRGBA, data AllData) error) (AllData, error) {
+	if err := opts.validate(); err != nil {
+		return AllData{}, err
+	}
+	if err := data.Apply(opts.Overrides); err != nil {
+		return AllData{}, err
+	}
+	if err := data.validate(); err != nil {
+		return AllData{}, err
+	}
+	if opts.ZoomOut {
+		data.Scale = .5
+	}
+	return renderTimeline(ctx, data, t, opts, frame)
+}
+
+func renderTimeline(ctx context.Context, allData AllData, t *Timeline, opts Options, frame func(i int, img *image.NRGBA, data AllData) error) (AllData, error) {
+	if err := t.Validate(); err != nil {
+		return AllData{}, err
+	}
+	var first AllData
+	r := newRenderer(opts)
+	for i := 0; i < t.Frames; i++ {
+		frameData, err := t.FrameData(allData, i)
+		if err != nil {
+			return AllData{}, err
+		}
+		if i == 0 {
+			first = frameData
+		}
+		r.opts.Progress = frameProgress(opts.Progress, i, t.Frames)
+		img, err := r.render(ctx, frameData)
+		if err != nil {
+			return AllData{}, err
+		}
+		if err := frame(i, img, frameData); err != nil {
+			return AllData{}, err
+		}
+	}
+	return first, nil
+}
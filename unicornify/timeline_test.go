@@ -0,0 +1,137 @@
+package unicornify
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTimeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"minimal", `{"Keyframes": [{"Frame": 0, "Set": {"NeckTilt": 10}}]}`, ""},
+		{"unknown key", `{"Keyframes": [{"Frame": 0}], "Speed": 2}`, "invalid timeline"},
+		{"no keyframes", `{"Keyframes": []}`, "at least one keyframe"},
+		{"negative fps", `{"FPS": -1, "Keyframes": [{"Frame": 0}]}`, "FPS"},
+		{"negative frames", `{"Frames": -1, "Keyframes": [{"Frame": 0}]}`, "frame count"},
+		{"negative frame", `{"Keyframes": [{"Frame": -1}]}`, "must not be negative"},
+		{"duplicate frame", `{"Keyframes": [{"Frame": 3}, {"Frame": 3}]}`, "several keyframes"},
+		{"easing", `{"Keyframes": [{"Frame": 0, "Easing": "bounce"}]}`, "unknown easing"},
+		{"unknown field", `{"Keyframes": [{"Frame": 0, "Set": {"Nope": 1}}]}`, "unknown field"},
+		{"out of range", `{"Keyframes": [{"Frame": 0, "Set": {"HornHue": 400}}]}`, "between"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTimeline(strings.NewReader(tt.json))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%v: %v", tt.name, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%v: no error", tt.name)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%v: error %q doesn't mention %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTimelineValidateDefaults(t *testing.T) {
+	tl := &Timeline{Keyframes: []Keyframe{
+		{Frame: 10, Set: map[string]float64{"NeckTilt": 10}},
+		{Frame: 0, Set: map[string]float64{"NeckTilt": 0}},
+		{Frame: 4, Set: map[string]float64{"FaceTilt": 0}},
+	}}
+	if err := tl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tl.FPS != DefaultFPS || tl.Frames != 11 {
+		t.Errorf("got FPS %v and %v frames, want %v and 11", tl.FPS, tl.Frames, DefaultFPS)
+	}
+	for i, want := range []int{0, 4, 10} {
+		if tl.Keyframes[i].Frame != want {
+			t.Errorf("keyframe %v has frame %v, want %v", i, tl.Keyframes[i].Frame, want)
+		}
+	}
+}
+
+func TestTimelineOverrides(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   float64
+		field  string
+		easing string
+		want   []float64 // at frames 0 to 4
+	}{
+		{"linear", 0, 40, "NeckTilt", "", []float64{0, 10, 20, 30, 40}},
+		{"linear explicitly", 40, 0, "NeckTilt", "linear", []float64{40, 30, 20, 10, 0}},
+		{"smooth", 0, 32, "NeckTilt", "smooth", []float64{0, 5, 16, 27, 32}},
+		{"step", 0, 40, "NeckTilt", "step", []float64{0, 0, 0, 0, 40}},
+		{"whole numbers", 0, 5, "PoseKindIndex", "", []float64{0, 1, 3, 4, 5}},
+		{"hue up across 0", 350, 10, "HornHue", "", []float64{350, 355, 0, 5, 10}},
+		{"hue down across 0", 10, 350, "SkyHue", "", []float64{10, 5, 0, 355, 350}},
+		{"hue the short way", 100, 200, "BackgroundData.LandHue", "", []float64{100, 125, 150, 175, 200}},
+		{"hue rounded across 0", 359, 1, "BodyHue", "linear", []float64{359, 0, 0, 1, 1}},
+	}
+	for _, tt := range tests {
+		tl := &Timeline{Keyframes: []Keyframe{
+			{Frame: 0, Set: map[string]float64{tt.field: tt.a}},
+			{Frame: 4, Set: map[string]float64{tt.field: tt.b}, Easing: tt.easing},
+		}}
+		for frame, want := range tt.want {
+			got := tl.Overrides(frame)
+			if len(got) != 1 || got[0].Field != tt.field || math.Abs(got[0].Value-want) > 1e-9 {
+				t.Errorf("%v: frame %v: got %v, want %v", tt.name, frame, got, want)
+			}
+		}
+	}
+}
+
+func TestTimelineOverridesHoldValues(t *testing.T) {
+	// fields are held before their first and after their last keyframe,
+	// independently of each other
+	tl := &Timeline{Keyframes: []Keyframe{
+		{Frame: 2, Set: map[string]float64{"NeckTilt": 10}},
+		{Frame: 4, Set: map[string]float64{"FaceTilt": -20}},
+		{Frame: 6, Set: map[string]float64{"NeckTilt": 30}},
+	}}
+	tests := []struct {
+		frame int
+		want  []Override
+	}{
+		{0, []Override{{"FaceTilt", -20}, {"NeckTilt", 10}}},
+		{3, []Override{{"FaceTilt", -20}, {"NeckTilt", 15}}},
+		{6, []Override{{"FaceTilt", -20}, {"NeckTilt", 30}}},
+		{100, []Override{{"FaceTilt", -20}, {"NeckTilt", 30}}},
+	}
+	for _, tt := range tests {
+		if got := tl.Overrides(tt.frame); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("frame %v: got %v, want %v", tt.frame, got, tt.want)
+		}
+	}
+}
+
+func TestTimelineFrameDataKeepsJoints(t *testing.T) {
+	data, err := randomize("0123456789abcdef0123456789abcdef", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.Apply([]Override{{"Joints.neck.Z", 10}}); err != nil {
+		t.Fatal(err)
+	}
+	tl := &Timeline{Keyframes: []Keyframe{{Frame: 0, Set: map[string]float64{"Joints.neck.Z": 40}}}}
+	if err := tl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := tl.FrameData(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(frame.UnicornData.Joints[JointNeck].Z, 40*math.Pi/180) {
+		t.Errorf("frame data has neck rotation %v", frame.UnicornData.Joints[JointNeck])
+	}
+	if !approx(data.UnicornData.Joints[JointNeck].Z, 10*math.Pi/180) {
+		t.Errorf("FrameData changed the original joints to %v", data.UnicornData.Joints[JointNeck])
+	}
+}
@@ -0,0 +1,117 @@
+package unicornify
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+
+	. "github.com/balpha/go-unicornify/unicornify/core"
+)
+
+// RenderTurntable renders frameCount frames of the camera circling the
+// unicorn with the given hash once (see Render), at the elevation given by
+// XAngle (usually set with an Override). The first frame shows the unicorn
+// from the angle derived from the hash; the others follow in equal steps, so
+// the frames can be played in a loop. The unicorn keeps its pose, and the
+// light stays fixed relative to the unicorn rather than to the camera, so the
+// shading moves as the camera goes around. The returned AllData is that of
+// the first frame.
+func RenderTurntable(ctx context.Context, hash string, frameCount int, opts Options) ([]*image.NRGBA, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	allData, err := randomize(hash, opts.ZoomOut)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	if err := allData.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	frames, err := renderTurntable(ctx, allData, frameCount, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return frames, allData, nil
+}
+
+// RenderTurntableFromData is like RenderTurntable, but for the unicorn
+// described by data. The YAngle in data is used for the first frame. The
+// returned AllData is that of the first frame, with the overrides in opts
+// applied.
+func RenderTurntableFromData(ctx context.Context, data AllData, frameCount int, opts Options) ([]*image.NRGBA, AllData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.Apply(opts.Overrides); err != nil {
+		return nil, AllData{}, err
+	}
+	if err := data.validate(); err != nil {
+		return nil, AllData{}, err
+	}
+	if opts.ZoomOut {
+		data.Scale = .5
+	}
+	frames, err := renderTurntable(ctx, data, frameCount, opts)
+	if err != nil {
+		return nil, AllData{}, err
+	}
+	return frames, data, nil
+}
+
+// tilt rotates v the way newScene tilts the unicorn for a camera below the
+// horizon, or back if undo is set.
+func tilt(v Vector, xAngle, yAngle float64, undo bool) Vector {
+	if undo {
+		xAngle = -xAngle
+	}
+	return v.RotatedAround(Vector{}, yAngle, 1).RotatedAround(Vector{}, xAngle, 0).RotatedAround(Vector{}, -yAngle, 1)
+}
+
+func renderTurntable(ctx context.Context, allData AllData, frameCount int, opts Options) ([]*image.NRGBA, error) {
+	if frameCount <= 0 {
+		return nil, errors.New("frame count must be a positive number")
+	}
+	startAngle := allData.YAngle
+
+	r := newRenderer(opts)
+	frames := make([]*image.NRGBA, frameCount)
+	for i := range frames {
+		frameData := allData
+		frameData.YAngle = startAngle + 2*math.Pi*float64(i)/float64(frameCount)
+		if i > 0 && allData.XAngle < 0 {
+			// The scene doesn't lower the camera, but tilts the unicorn
+			// instead (see newScene), so the light has to follow the tilt.
+			light := tilt(allData.LightDirection, allData.XAngle, startAngle, true)
+			frameData.LightDirection = tilt(light, allData.XAngle, frameData.YAngle, false)
+		}
+
+		r.opts.Progress = frameProgress(opts.Progress, i, frameCount)
+		var err error
+		frames[i], err = r.render(ctx, frameData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return frames, nil
+}
+
+// MakeSpriteSheet puts the frames, which must all have the same size, next to
+// each other in a grid with the given number of columns, row by row.
+func MakeSpriteSheet(frames []*image.NRGBA, columns int) *image.NRGBA {
+	if len(frames) == 0 {
+		return image.NewNRGBA(image.Rectangle{})
+	}
+	if columns <= 0 || columns > len(frames) {
+		columns = len(frames)
+	}
+	rows := (len(frames) + columns - 1) / columns
+	w, h := frames[0].Bounds().Dx(), frames[0].Bounds().Dy()
+	sheet := image.NewNRGBA(image.Rect(0, 0, columns*w, rows*h))
+	for i, f := range frames {
+		at := image.Pt(i%columns*w, i/columns*h)
+		draw.Draw(sheet, image.Rectangle{at, at.Add(image.Pt(w, h))}, f, f.Bounds().Min, draw.Src)
+	}
+	return sheet
+}
@@ -12,12 +12,16 @@ type Unicorn struct {
 	Head, Snout, Shoulder, Butt, HornOnset, HornTip *Ball
 	EyeLeft, EyeRight, PupilLeft, PupilRight        *Ball
 	TailStart, TailEnd                              *Ball
+	TailMid                                         *Ball // nil unless the tail is bent in the middle
 	BrowLeftInner, BrowLeftMiddle, BrowLeftOuter    *Ball
 	BrowRightInner, BrowRightMiddle, BrowRightOuter *Ball
 	Tail                                            *Bone
 	Legs                                            [4]Leg
 	Hairs                                           *Figure
 	EarLeft, EarRight                               *Figure
+	WingLeft, WingRight                             *Figure // nil if the unicorn has no wings
+
+	face *Figure // everything that moves with the head joint
 }
 
 var red = Color{255, 0, 0}
@@ -58,7 +62,8 @@ func NewUnicorn(data UnicornData) *Unicorn {
 
 	eyecurve := gammaFunc(1.5)
 
-	u.Add(
+	u.face = &Figure{}
+	u.face.Add(
 		NewBone(u.Snout, u.Head),
 		NewBone(u.HornOnset, u.HornTip),
 		u.EyeLeft, u.EyeRight,
@@ -69,26 +74,24 @@ func NewUnicorn(data UnicornData) *Unicorn {
 		NewNonLinBone(u.BrowRightMiddle, u.BrowRightOuter, nil, eyecurve),
 		u.EarLeft, u.EarRight,
 	)
-
-	for b := range u.BallSet() {
-		b.RotateAround(*u.Head, data.FaceTilt, 0)
-	}
-
+	u.Add(u.face.Things()...)
 	u.Add(NewBone(u.Head, u.Shoulder))
 	u.Add(u.Hairs)
-
-	for b := range u.BallSet() {
-		b.RotateAround(*u.Shoulder, data.NeckTilt, 1)
-	}
-
 	u.Add(
 		NewBone(u.Shoulder, u.Butt),
 		u.Tail,
 	)
 
+	if data.HasWings {
+		u.makeWings(data)
+		u.Add(u.WingLeft, u.WingRight)
+	}
+
 	for _, l := range u.Legs {
 		u.Add(l.Calf, l.Shin)
 	}
+	u.Skeleton().Apply(data.jointPose())
+	u.assignParts()
 	return u
 }
 
@@ -180,6 +183,77 @@ func (u *Unicorn) makeMane(data UnicornData) {
 	}
 }
 
+// makeWing creates a feathered wing on top of the shoulder. The wing consists
+// of an arm going out to the side and upwards, the flight feathers, which fan
+// out from pointing backwards at the shoulder to pointing outwards at the tip,
+// and a flat covert area that covers the feathers' bases.
+func (u *Unicorn) makeWing(data UnicornData, side float64) *Figure {
+	span := data.WingSpan
+	out := Vector{0, -math.Sin(data.WingLift), side * math.Cos(data.WingLift)}
+	back := Vector{1, 0, 0}
+	up := back.CrossProd(out).Times(side) // perpendicular to the wing
+
+	rootPos := u.Shoulder.Center.Plus(Vector{0.3, -0.7, side * 0.65}.Unit().Times(u.Shoulder.Radius - 5))
+	root := NewBallP(rootPos, 8, data.Color("Wing", 55))
+	wrist := NewBallP(rootPos.Plus(out.Times(0.45*span)).Plus(back.Times(0.1*span)), 5, data.Color("Wing", 65))
+	tip := NewBallP(rootPos.Plus(out.Times(span)).Plus(back.Times(0.35*span)), 3, data.Color("Wing", 80))
+
+	result := &Figure{}
+	armcurve := gammaFuncTimes(1.5, 0.3)
+	result.Add(
+		NewNonLinBone(root, wrist, nil, armcurve),
+		NewNonLinBone(wrist, tip, nil, armcurve),
+	)
+
+	// The feathers are slightly stacked, so that each one lies on top of
+	// the one before it.
+	count := data.WingFeatherCount
+	armLength := wrist.Center.Minus(root.Center).Length() + tip.Center.Minus(wrist.Center).Length()
+	width := 1.5 * armLength / float64(count)
+	for i := 0; i < count; i++ {
+		t := float64(i) / float64(count)
+		var anchor Vector
+		if t < 0.5 {
+			anchor = root.Center.Plus(wrist.Center.Minus(root.Center).Times(t / 0.5))
+		} else {
+			anchor = wrist.Center.Plus(tip.Center.Minus(wrist.Center).Times((t - 0.5) / 0.5))
+		}
+		anchor = anchor.Plus(up.Times(float64(i)))
+		angle := t * 70 * DEGREE
+		dir := back.Times(math.Cos(angle)).Plus(out.Times(math.Sin(angle)))
+		perp := out.Times(math.Cos(angle)).Minus(back.Times(math.Sin(angle)))
+		length := span * (0.3 + 0.25*t)
+
+		lightness := 60 + 10*(i%2)
+		feather := NewSteak(
+			NewBallP(anchor, 1.5, data.Color("Wing", lightness)),
+			NewBallP(anchor.Plus(perp.Times(width)), 1.5, data.Color("Wing", lightness)),
+			NewBallP(anchor.Plus(dir.Times(length)), 1.5, data.Color("Wing", lightness+20)),
+		)
+		feather.FourCorners = true
+		feather.FourthColor = data.Color("Wing", lightness+20)
+		feather.Rounded = true
+		result.Add(feather)
+	}
+
+	covertsPos := root.Center.Plus(up.Times(float64(count) + 2))
+	coverts := NewSteak(
+		NewBallP(covertsPos, 3, data.Color("Wing", 55)),
+		NewBallP(covertsPos.Plus(wrist.Center.Minus(root.Center)), 3, data.Color("Wing", 65)),
+		NewBallP(covertsPos.Plus(back.Times(0.3*span)), 3, data.Color("Wing", 60)),
+	)
+	coverts.FourCorners = true
+	coverts.FourthColor = data.Color("Wing", 70)
+	coverts.Rounded = true
+	result.Add(coverts)
+	return result
+}
+
+func (u *Unicorn) makeWings(data UnicornData) {
+	u.WingLeft = u.makeWing(data, -1)
+	u.WingRight = u.makeWing(data, 1)
+}
+
 func gammaFunc(gamma float64) func(float64) float64 {
 	return gammaFuncTimes(gamma, 1)
 }
@@ -48,7 +48,18 @@ type UnicornData struct {
 	NeckTilt float64
 	FaceTilt float64
 
+	// Joints rotates joints of the skeleton in addition to the pose and
+	// the neck and face tilt.
+	Joints Pose `json:",omitempty"`
+
 	EarLength float64
+
+	HasWings         bool
+	WingHue          int
+	WingSat          int
+	WingSpan         float64
+	WingLift         float64 // the angle of the wings above the horizontal
+	WingFeatherCount int
 }
 
 func (d UnicornData) Color(name string, lightness int) Color {
@@ -111,7 +122,7 @@ func (d *UnicornData) Randomize2(rand *pyrand.Random) {
 }
 
 func (d *UnicornData) Randomize3(rand *pyrand.Random) {
-	d.PoseKindIndex = rand.Choice(len(Poses))
+	d.PoseKindIndex = rand.Choice(randomPoseCount)
 	d.PoseKind = Poses[d.PoseKindIndex]
 	d.PosePhase = rand.Random()
 }
@@ -126,6 +137,16 @@ func (d *UnicornData) Randomize5(rand *pyrand.Random) {
 	d.EarLength = float64(rand.RandInt(30, 35))
 }
 
+// Randomize6 determines what the unicorn's wings look like; it doesn't decide
+// whether it has any.
+func (d *UnicornData) Randomize6(rand *pyrand.Random) {
+	d.WingHue = (d.BodyHue + rand.RandInt(-40, 40) + 360) % 360
+	d.WingSat = rand.RandInt(20, 80)
+	d.WingSpan = float64(rand.RandInt(120, 200))
+	d.WingLift = float64(rand.RandInt(10, 50)) * DEGREE
+	d.WingFeatherCount = rand.RandInt(6, 12)
+}
+
 func (d *UnicornData) MakeHair1(rand *pyrand.Random, start, count int) {
 	for i := start; i < start+count; i++ {
 		d.HairStarts[i] = float64(rand.RandInt(-20, 100))
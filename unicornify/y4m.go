@@ -0,0 +1,56 @@
+package unicornify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// A Y4MWriter writes frames as an uncompressed YUV4MPEG2 video, which most
+// video tools (like ffmpeg) can read. The frames are stored in full range
+// 4:4:4 YCbCr; transparent pixels are composited onto white.
+type Y4MWriter struct {
+	w             *bufio.Writer
+	fps           int
+	width, height int
+}
+
+// NewY4MWriter returns a writer for a video with the given frame rate. The
+// size of the video is that of the first frame.
+func NewY4MWriter(w io.Writer, fps int) *Y4MWriter {
+	return &Y4MWriter{w: bufio.NewWriter(w), fps: fps}
+}
+
+// WriteFrame appends a frame to the video. All frames must have the same size.
+func (y *Y4MWriter) WriteFrame(img *image.NRGBA) error {
+	b := img.Bounds()
+	if y.width == 0 {
+		y.width, y.height = b.Dx(), b.Dy()
+		fmt.Fprintf(y.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444 XCOLORRANGE=FULL\n", y.width, y.height, y.fps)
+	} else if b.Dx() != y.width || b.Dy() != y.height {
+		return errors.New("all frames of a video must have the same size")
+	}
+
+	opaque := onWhite(img)
+	planes := make([][]byte, 3)
+	for i := range planes {
+		planes[i] = make([]byte, 0, y.width*y.height)
+	}
+	for py := b.Min.Y; py < b.Max.Y; py++ {
+		for px := b.Min.X; px < b.Max.X; px++ {
+			c := color.RGBAModel.Convert(opaque.At(px, py)).(color.RGBA)
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			planes[0] = append(planes[0], yy)
+			planes[1] = append(planes[1], cb)
+			planes[2] = append(planes[2], cr)
+		}
+	}
+	y.w.WriteString("FRAME\n")
+	for _, p := range planes {
+		y.w.Write(p)
+	}
+	return y.w.Flush()
+}